@@ -1,9 +1,9 @@
 package main
 
 import (
-	_ "embed"
 	"encoding/json"
 	"fmt"
+	"os"
 	"testing"
 
 	"vsc-node/lib/test_utils"
@@ -13,8 +13,21 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-//go:embed artifacts/main.wasm
-var ContractWasm []byte
+// wasmForTest returns a contract built into artifacts/, which is not checked
+// in, and skips t until it has been built with build
+func wasmForTest(t *testing.T, file, build string) []byte {
+	t.Helper()
+	wasm, err := os.ReadFile("artifacts/" + file)
+	if err != nil {
+		t.Skip("artifacts/" + file + " not built: " + build)
+	}
+	return wasm
+}
+
+// contractWasm returns the dex-router contract built from this package
+func contractWasm(t *testing.T) []byte {
+	return wasmForTest(t, "main.wasm", "tinygo build -o artifacts/main.wasm -target wasm .")
+}
 
 func printKeys(ct *test_utils.ContractTest, contractId string, keys []string) {
 	for _, key := range keys {
@@ -25,7 +38,7 @@ func printKeys(ct *test_utils.ContractTest, contractId string, keys []string) {
 func TestDexRouterInit(t *testing.T) {
 	ct := test_utils.NewContractTest()
 	contractId := "dex_router"
-	ct.RegisterContract(contractId, "hive:alice", ContractWasm)
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
 
 	result, gasUsed, logs := ct.Call(stateEngine.TxVscCallContract{
 		Self: stateEngine.TxSelf{
@@ -75,7 +88,7 @@ func TestDexRouterInit(t *testing.T) {
 func TestCreatePool(t *testing.T) {
 	ct := test_utils.NewContractTest()
 	contractId := "dex_router"
-	ct.RegisterContract(contractId, "hive:alice", ContractWasm)
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
 
 	// Initialize contract first
 	ct.Call(stateEngine.TxVscCallContract{
@@ -144,6 +157,10 @@ func TestCreatePool(t *testing.T) {
 	assert.Equal(t, `"HIVE"`, poolAsset1)
 	assert.Equal(t, `"8"`, poolFee)
 
+	// Check pair index was written
+	assert.Equal(t, `"1"`, ct.StateGet(contractId, "pair/HBD/HIVE/8"))
+	assert.Equal(t, `"8"`, ct.StateGet(contractId, "pair/HBD/HIVE/tiers"))
+
 	// Check next pool ID was incremented
 	nextPoolId := ct.StateGet(contractId, "next_pool_id")
 	assert.Equal(t, `"2"`, nextPoolId)
@@ -151,32 +168,55 @@ func TestCreatePool(t *testing.T) {
 	fmt.Println("Return value:", result.Ret)
 }
 
+func TestCreatePoolDuplicatePair(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+
+	// Same pair in reverse order must resolve to the existing pool
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "create_pool_dup_tx",
+			BlockId:              "block:create_pool_dup",
+			Index:                2,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:00:02Z",
+			RequiredAuths:        []string{"hive:alice"},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "create_pool",
+		Payload: json.RawMessage([]byte(`{
+			"asset0": "HIVE",
+			"asset1": "HBD",
+			"fee_bps": 8
+		}`)),
+		RcLimit: 10000,
+		Intents: []contracts.Intent{},
+		Caller:  "hive:alice",
+	})
+
+	assertError(t, result, "E_POOL_EXISTS", "pool already exists for pair")
+
+	// No second pool was allocated
+	assert.Equal(t, `"2"`, ct.StateGet(contractId, "next_pool_id"))
+	assert.Equal(t, "", ct.StateGet(contractId, "pool/2/asset0"))
+}
+
 func TestAddLiquidity(t *testing.T) {
 	ct := test_utils.NewContractTest()
 	contractId := "dex_router"
-	ct.RegisterContract(contractId, "hive:alice", ContractWasm)
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
 
 	// Initialize and create pool
 	setupDexTest(&ct, contractId)
 
 	// Add liquidity with proper intents
 	intents := []contracts.Intent{
-		{
-			Contract: contractId,
-			To:       "dex_router",
-			From:     "hive:alice",
-			Asset:    "HBD",
-			Amount:   1000000,
-			Memo:     "",
-		},
-		{
-			Contract: contractId,
-			To:       "dex_router",
-			From:     "hive:alice",
-			Asset:    "HIVE",
-			Amount:   500000,
-			Memo:     "",
-		},
+		allowIntent("HBD", 1000000),
+		allowIntent("HIVE", 500000),
 	}
 
 	result, gasUsed, logs := ct.Call(stateEngine.TxVscCallContract{
@@ -198,8 +238,8 @@ func TestAddLiquidity(t *testing.T) {
 			"asset_out": "HIVE",
 			"recipient": "hive:alice",
 			"metadata": {
-				"amount0": "1000000",
-				"amount1": "500000"
+				"amount0": 1000000,
+				"amount1": 500000
 			}
 		}`)),
 		RcLimit: 10000,
@@ -239,7 +279,7 @@ func TestAddLiquidity(t *testing.T) {
 func TestDirectSwap(t *testing.T) {
 	ct := test_utils.NewContractTest()
 	contractId := "dex_router"
-	ct.RegisterContract(contractId, "hive:alice", ContractWasm)
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
 
 	// Setup pool with liquidity
 	setupDexTest(&ct, contractId)
@@ -247,14 +287,7 @@ func TestDirectSwap(t *testing.T) {
 
 	// Execute swap with proper intents
 	intents := []contracts.Intent{
-		{
-			Contract: contractId,
-			To:       "dex_router",
-			From:     "hive:bob",
-			Asset:    "HBD",
-			Amount:   100000,
-			Memo:     "",
-		},
+		allowIntent("HBD", 100000),
 	}
 
 	result, gasUsed, logs := ct.Call(stateEngine.TxVscCallContract{
@@ -275,8 +308,9 @@ func TestDirectSwap(t *testing.T) {
 			"asset_in": "HBD",
 			"asset_out": "HIVE",
 			"recipient": "hive:bob",
+			"amount_in": 100000,
 			"min_amount_out": 47500,
-			"slippage_bps": 50
+			"slippage_bps": 500
 		}`)),
 		RcLimit: 10000,
 		Intents: intents,
@@ -303,41 +337,140 @@ func TestDirectSwap(t *testing.T) {
 	reserve0 := ct.StateGet(contractId, "pool/1/reserve0") // HBD
 	reserve1 := ct.StateGet(contractId, "pool/1/reserve1") // HIVE
 
-	// Input: 100000 HBD, expected output: ~47619 HIVE (after 0.08% fee)
-	// New reserves: HBD: 2000000 + 99920 = 2099920, HIVE: 1000000 - 47619 = 952381
+	// Input: 100000 HBD, 99920 after the 0.08% fee
+	// Output: 99920 * 1000000 / 2099920 = 47582 HIVE, rounded down in favour of the pool
+	// New reserves: HBD: 2000000 + 99920 = 2099920, HIVE: 1000000 - 47582 = 952418
 	assert.Equal(t, `"2099920"`, reserve0)
-	assert.Equal(t, `"952381"`, reserve1)
+	assert.Equal(t, `"952418"`, reserve1)
 
 	fmt.Println("Return value:", result.Ret)
 }
 
-// Helper functions
+func TestSwapSlippageExceeded(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
 
-func setupDexTest(ct *test_utils.ContractTest, contractId string) {
-	// Initialize contract
-	ct.Call(stateEngine.TxVscCallContract{
+	setupDexTest(&ct, contractId)
+	addLiquidityToPool(&ct, contractId, "1", 2000000, 1000000) // 2000 HBD : 1000 HIVE
+
+	intents := []contracts.Intent{
+		allowIntent("HBD", 100000),
+	}
+
+	// 100 HBD into this pool moves the price ~4.8%, well past a 0.5% tolerance
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
 		Self: stateEngine.TxSelf{
-			TxId:                 "init_tx",
-			BlockId:              "block:init",
-			Index:                0,
+			TxId:                 "swap_slippage_tx",
+			BlockId:              "block:swap_slippage",
+			Index:                3,
 			OpIndex:              0,
-			Timestamp:            "2025-01-01T00:00:00Z",
-			RequiredAuths:        []string{"hive:alice"},
+			Timestamp:            "2025-01-01T00:00:03Z",
+			RequiredAuths:        []string{"hive:bob"},
 			RequiredPostingAuths: []string{},
 		},
 		ContractId: contractId,
-		Action:     "init",
-		Payload:    json.RawMessage([]byte(`"1.0.0"`)),
-		RcLimit:    10000,
-		Intents:    []contracts.Intent{},
-		Caller:     "hive:alice",
+		Action:     "execute",
+		Payload: json.RawMessage([]byte(`{
+			"type": "swap",
+			"version": "1.0.0",
+			"asset_in": "HBD",
+			"asset_out": "HIVE",
+			"recipient": "hive:bob",
+			"amount_in": 100000,
+			"slippage_bps": 50
+		}`)),
+		RcLimit: 10000,
+		Intents: intents,
+		Caller:  "hive:bob",
 	})
 
-	// Create HIVE-HBD pool
-	ct.Call(stateEngine.TxVscCallContract{
+	assert.False(t, result.Success)
+
+	// Reserves must be untouched
+	assert.Equal(t, `"2000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"1000000"`, ct.StateGet(contractId, "pool/1/reserve1"))
+}
+
+func TestMultiHopSwap(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	// BTC/HIVE and HIVE/HBD pools, no direct BTC/HBD pool
+	setupDexTest(&ct, contractId)
+	createPoolForPair(&ct, contractId, "BTC", "HIVE")
+	addLiquidityForPair(&ct, contractId, "BTC", "HIVE", 1000000, 50000000)
+	addLiquidityForPair(&ct, contractId, "HBD", "HIVE", 10000000, 40000000)
+
+	intents := []contracts.Intent{
+		allowIntent("BTC", 1000),
+	}
+
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
 		Self: stateEngine.TxSelf{
-			TxId:                 "create_pool_tx",
-			BlockId:              "block:create_pool",
+			TxId:                 "multi_hop_tx",
+			BlockId:              "block:multi_hop",
+			Index:                4,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:00:04Z",
+			RequiredAuths:        []string{"hive:bob"},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "execute",
+		Payload: json.RawMessage([]byte(`{
+			"type": "swap",
+			"version": "1.0.0",
+			"asset_in": "BTC",
+			"asset_out": "HBD",
+			"recipient": "hive:bob",
+			"amount_in": 1000,
+			"path": ["BTC", "HIVE", "HBD"],
+			"slippage_bps": 100
+		}`)),
+		RcLimit: 10000,
+		Intents: intents,
+		Caller:  "hive:bob",
+	})
+
+	assert.True(t, result.Success)
+
+	// Both pools moved: BTC in to pool 2, HIVE routed through to pool 1
+	assert.NotEqual(t, `"1000000"`, ct.StateGet(contractId, "pool/2/reserve0"))
+	assert.NotEqual(t, `"40000000"`, ct.StateGet(contractId, "pool/1/reserve1"))
+
+	// One swap_executed event per hop, carrying the reserves after the hop
+	var envelope struct {
+		V      int `json:"v"`
+		Events []struct {
+			Type     string `json:"type"`
+			PoolId   string `json:"pool_id"`
+			Reserve0 uint64 `json:"reserve0"`
+			Reserve1 uint64 `json:"reserve1"`
+		} `json:"events"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &envelope))
+	assert.Equal(t, 1, envelope.V)
+	assert.Len(t, envelope.Events, 2)
+	for _, event := range envelope.Events {
+		assert.Equal(t, "swap_executed", event.Type)
+		assert.Equal(t, fmt.Sprintf(`"%d"`, event.Reserve0), ct.StateGet(contractId, "pool/"+event.PoolId+"/reserve0"))
+		assert.Equal(t, fmt.Sprintf(`"%d"`, event.Reserve1), ct.StateGet(contractId, "pool/"+event.PoolId+"/reserve1"))
+	}
+}
+
+func TestSwapFeeSplit(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	// 1% fee, half of it to the protocol and half left to LPs
+	setupDexTest(&ct, contractId)
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "create_split_pool_tx",
+			BlockId:              "block:create_split_pool",
 			Index:                1,
 			OpIndex:              0,
 			Timestamp:            "2025-01-01T00:00:01Z",
@@ -346,62 +479,1513 @@ func setupDexTest(ct *test_utils.ContractTest, contractId string) {
 		},
 		ContractId: contractId,
 		Action:     "create_pool",
-		Payload: json.RawMessage([]byte(`{
-			"asset0": "HBD",
-			"asset1": "HIVE",
-			"fee_bps": 8
-		}`)),
+		Payload:    json.RawMessage([]byte(`{"asset0": "BTC", "asset1": "HIVE", "fee_bps": 100, "protocol_share_bps": 5000}`)),
 		RcLimit:    10000,
 		Intents:    []contracts.Intent{},
 		Caller:     "hive:alice",
 	})
-}
+	assert.True(t, result.Success)
+	addLiquidityForPair(&ct, contractId, "BTC", "HIVE", 1000000, 1000000)
 
-func addLiquidityToPool(ct *test_utils.ContractTest, contractId, poolId string, amt0, amt1 uint64) {
+	// Swap in the asset1 -> asset0 direction with a non-HBD input
 	intents := []contracts.Intent{
-		{
-			Contract: contractId,
-			To:       "dex_router",
-			From:     "hive:alice",
-			Asset:    "HBD",
-			Amount:   int64(amt0),
-			Memo:     "",
+		allowIntent("HIVE", 10000),
+	}
+
+	result, _, _ = ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "split_swap_tx",
+			BlockId:              "block:split_swap",
+			Index:                3,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:00:03Z",
+			RequiredAuths:        []string{"hive:bob"},
+			RequiredPostingAuths: []string{},
 		},
-		{
-			Contract: contractId,
-			To:       "dex_router",
-			From:     "hive:alice",
-			Asset:    "HIVE",
-			Amount:   int64(amt1),
-			Memo:     "",
+		ContractId: contractId,
+		Action:     "execute",
+		Payload: json.RawMessage([]byte(`{
+			"type": "swap",
+			"version": "1.0.0",
+			"asset_in": "HIVE",
+			"asset_out": "BTC",
+			"recipient": "hive:bob",
+			"amount_in": 10000
+		}`)),
+		RcLimit: 10000,
+		Intents: intents,
+		Caller:  "hive:bob",
+	})
+
+	assert.True(t, result.Success)
+
+	// Fee: 100 HIVE, 50 to the protocol and 50 left in the pool
+	// Output: 9900 * 1000000 / 1009900 = 9802 BTC
+	// New reserves: BTC: 1000000 - 9802 = 990198, HIVE: 1000000 + 10000 - 50 = 1009950
+	assert.Equal(t, `"50"`, ct.StateGet(contractId, "pool/2/fee1"))
+	assert.Equal(t, `"990198"`, ct.StateGet(contractId, "pool/2/reserve0"))
+	assert.Equal(t, `"1009950"`, ct.StateGet(contractId, "pool/2/reserve1"))
+}
+
+func TestGetQuote(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	addLiquidityForPair(&ct, contractId, "HBD", "HIVE", 2000000, 1000000)
+
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "quote_tx",
+			BlockId:              "block:quote",
+			Index:                3,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:00:03Z",
+			RequiredAuths:        []string{"hive:bob"},
+			RequiredPostingAuths: []string{},
 		},
+		ContractId: contractId,
+		Action:     "get_quote",
+		Payload: json.RawMessage([]byte(`{
+			"type": "swap",
+			"version": "1.0.0",
+			"asset_in": "HBD",
+			"asset_out": "HIVE",
+			"recipient": "hive:bob",
+			"amount_in": 100000
+		}`)),
+		RcLimit: 10000,
+		Intents: []contracts.Intent{},
+		Caller:  "hive:bob",
+	})
+
+	assert.True(t, result.Success)
+
+	var quote struct {
+		AmountOut      uint64   `json:"amount_out"`
+		Path           []string `json:"path"`
+		PriceImpactBps uint64   `json:"price_impact_bps"`
+		Hops           []struct {
+			PoolId string `json:"pool_id"`
+			Fee    uint64 `json:"fee"`
+		} `json:"hops"`
 	}
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &quote))
 
-	ct.Call(stateEngine.TxVscCallContract{
+	// Same math as TestDirectSwap: 99920 * 1000000 / 2099920 = 47582 HIVE
+	assert.Equal(t, uint64(47582), quote.AmountOut)
+	assert.Equal(t, []string{"HBD", "HIVE"}, quote.Path)
+	assert.Len(t, quote.Hops, 1)
+	assert.Equal(t, "1", quote.Hops[0].PoolId)
+	assert.Equal(t, uint64(80), quote.Hops[0].Fee)
+	// Spot 99920 * 1000000 / 2000000 = 49960, 47582 is 475 bps below it
+	assert.Equal(t, uint64(475), quote.PriceImpactBps)
+
+	// Quoting leaves the pool untouched
+	assert.Equal(t, `"2000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"1000000"`, ct.StateGet(contractId, "pool/1/reserve1"))
+}
+
+func TestPoolQueries(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	createPoolForPair(&ct, contractId, "BTC", "HIVE")
+	addLiquidityForPair(&ct, contractId, "BTC", "HIVE", 1000000, 50000000)
+
+	query := func(action, payload string) string {
+		result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+			Self: stateEngine.TxSelf{
+				TxId:                 "query_tx_" + action,
+				BlockId:              "block:query",
+				Index:                5,
+				OpIndex:              0,
+				Timestamp:            "2025-01-01T00:02:00Z",
+				RequiredAuths:        []string{"hive:bob"},
+				RequiredPostingAuths: []string{},
+			},
+			ContractId: contractId,
+			Action:     action,
+			Payload:    json.RawMessage([]byte(payload)),
+			RcLimit:    10000,
+			Intents:    []contracts.Intent{},
+			Caller:     "hive:bob",
+		})
+		assert.True(t, result.Success)
+		return result.Ret
+	}
+
+	var page struct {
+		Total uint64 `json:"total"`
+		Pools []struct {
+			PoolId string `json:"pool_id"`
+			Asset0 string `json:"asset0"`
+		} `json:"pools"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(query("list_pools", `{"offset": 1, "limit": 1}`)), &page))
+	assert.Equal(t, uint64(2), page.Total)
+	assert.Len(t, page.Pools, 1)
+	assert.Equal(t, "2", page.Pools[0].PoolId)
+	assert.Equal(t, "BTC", page.Pools[0].Asset0)
+
+	var balance struct {
+		Balances []struct {
+			PoolId string `json:"pool_id"`
+			Lp     uint64 `json:"lp"`
+		} `json:"balances"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(query("get_lp_balance", `{"address": "hive:alice"}`)), &balance))
+	assert.Len(t, balance.Balances, 1)
+	assert.Equal(t, "2", balance.Balances[0].PoolId)
+	// sqrt(1000000 * 50000000) = 7071067, less the 1000 locked LP
+	assert.Equal(t, uint64(7070067), balance.Balances[0].Lp)
+
+	var fees struct {
+		Fee0         uint64 `json:"fee0"`
+		Fee1         uint64 `json:"fee1"`
+		FeeLastClaim string `json:"fee_last_claim"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(query("get_pool_fees", `"2"`)), &fees))
+	assert.Equal(t, uint64(0), fees.Fee0)
+	assert.Equal(t, uint64(0), fees.Fee1)
+	assert.NotEmpty(t, fees.FeeLastClaim)
+}
+
+func TestBalancedDeposit(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	addLiquidityForPair(&ct, contractId, "HBD", "HIVE", 2000000, 1000000)
+
+	deposit := func(txId string, minLP uint64) stateEngine.TxResult {
+		intents := []contracts.Intent{
+			allowIntent("HBD", 100000),
+			allowIntent("HIVE", 100000),
+		}
+		result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+			Self: stateEngine.TxSelf{
+				TxId:                 txId,
+				BlockId:              "block:" + txId,
+				Index:                3,
+				OpIndex:              0,
+				Timestamp:            "2025-01-01T00:02:00Z",
+				RequiredAuths:        []string{"hive:alice"},
+				RequiredPostingAuths: []string{},
+			},
+			ContractId: contractId,
+			Action:     "execute",
+			Payload: json.RawMessage(fmt.Sprintf(`{
+				"type": "deposit",
+				"version": "1.0.0",
+				"asset_in": "HBD",
+				"asset_out": "HIVE",
+				"recipient": "hive:alice",
+				"metadata": {"amount0": 100000, "amount1": 100000, "min_lp_out": %d}
+			}`, minLP)),
+			RcLimit: 10000,
+			Intents: intents,
+			Caller:  "hive:alice",
+		})
+		return result
+	}
+
+	// Pool ratio is 2:1, so only 50000 of the offered 100000 HIVE is drawn
+	// LP: 100000 * 1414213 / 2000000 = 70710
+	result := deposit("deposit_too_strict_tx", 80000)
+	assertError(t, result, "E_MIN_OUTPUT", "lp output below min_lp_out")
+	assert.Equal(t, `"2000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+
+	result = deposit("deposit_tx", 70000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"2100000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"1050000"`, ct.StateGet(contractId, "pool/1/reserve1"))
+	assert.Equal(t, `"1484923"`, ct.StateGet(contractId, "pool/1/total_lp"))
+}
+
+func TestMinimumLiquidityLocked(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+
+	// A first deposit that cannot cover the locked minimum is rejected
+	result := depositForTest(&ct, contractId, "dust_deposit_tx", "hive:alice", "HBD", "HIVE", 1000, 1000)
+	assertError(t, result, "E_INSUFFICIENT_LIQUIDITY", "insufficient initial liquidity")
+	assert.Equal(t, `"0"`, ct.StateGet(contractId, "pool/1/total_lp"))
+
+	// sqrt(2000000 * 1000000) = 1414213, of which 1000 is locked
+	result = depositForTest(&ct, contractId, "first_deposit_tx", "hive:alice", "HBD", "HIVE", 2000000, 1000000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1414213"`, ct.StateGet(contractId, "pool/1/total_lp"))
+	assert.Equal(t, `"1413213"`, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+	assert.Equal(t, `"1000"`, ct.StateGet(contractId, "pool/1/lp/system:burn"))
+
+	// Nobody can redeem the locked LP
+	result = withdrawForTest(&ct, contractId, "burn_withdraw_tx", "system:burn", "HBD", "HIVE", 1000)
+	assertError(t, result, "E_LOCKED_LIQUIDITY", "locked liquidity cannot be withdrawn")
+
+	// The provider exiting completely leaves the locked share behind, so the
+	// pool never returns to an empty supply
+	result = withdrawForTest(&ct, contractId, "full_withdraw_tx", "hive:alice", "HBD", "HIVE", 1413213)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1000"`, ct.StateGet(contractId, "pool/1/total_lp"))
+	assert.Equal(t, `"1415"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"708"`, ct.StateGet(contractId, "pool/1/reserve1"))
+}
+
+func TestDonationAttack(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+
+	// The attacker seeds the pool with the smallest allowed deposit and
+	// holds 1 LP out of 1001
+	result := depositForTest(&ct, contractId, "attacker_deposit_tx", "hive:alice", "HBD", "HIVE", 1001, 1001)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1"`, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+
+	// The attacker donates 10000000 of each asset straight to the pool,
+	// inflating the value of every LP unit
+	ct.StateSet(contractId, "pool/1/reserve0", `"10001001"`)
+	ct.StateSet(contractId, "pool/1/reserve1", `"10001001"`)
+
+	// The victim deposits 20000000 of each: 20000000 * 1001 / 10001001 = 2001 LP.
+	// Without the lock the supply would be 1 and the victim would get 1 LP,
+	// handing the attacker a quarter of the deposit.
+	result = depositForTest(&ct, contractId, "victim_deposit_tx", "hive:bob", "HBD", "HIVE", 20000000, 20000000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"2001"`, ct.StateGet(contractId, "pool/1/lp/hive:bob"))
+
+	// The victim redeems 2001 * 30001001 / 3002 = 19997336 of each asset,
+	// losing under 2 bps to rounding
+	result = withdrawForTest(&ct, contractId, "victim_withdraw_tx", "hive:bob", "HBD", "HIVE", 2001)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"10003665"`, ct.StateGet(contractId, "pool/1/reserve0"))
+
+	// The attacker's single LP redeems 1 * 10003665 / 1001 = 9993 of the
+	// 10001001 put in; the donation stays with the locked share
+	result = withdrawForTest(&ct, contractId, "attacker_withdraw_tx", "hive:alice", "HBD", "HIVE", 1)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"9993672"`, ct.StateGet(contractId, "pool/1/reserve0"))
+}
+
+func TestZapDeposit(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	addLiquidityForPair(&ct, contractId, "HBD", "HIVE", 2000000, 1000000)
+
+	// Bob holds only HIVE
+	intents := []contracts.Intent{
+		allowIntent("HIVE", 100000),
+	}
+
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
 		Self: stateEngine.TxSelf{
-			TxId:                 "add_liq_tx_" + poolId,
-			BlockId:              "block:add_liq_" + poolId,
-			Index:                100,
+			TxId:                 "zap_tx",
+			BlockId:              "block:zap",
+			Index:                3,
 			OpIndex:              0,
-			Timestamp:            "2025-01-01T00:01:00Z",
-			RequiredAuths:        []string{"hive:alice"},
+			Timestamp:            "2025-01-01T00:02:00Z",
+			RequiredAuths:        []string{"hive:bob"},
 			RequiredPostingAuths: []string{},
 		},
 		ContractId: contractId,
 		Action:     "execute",
-		Payload: json.RawMessage(fmt.Sprintf(`{
+		Payload: json.RawMessage([]byte(`{
 			"type": "deposit",
 			"version": "1.0.0",
-			"asset_in": "HBD",
-			"asset_out": "HIVE",
-			"recipient": "hive:alice",
-			"metadata": {
-				"amount0": "%d",
-				"amount1": "%d"
-			}
-		}`, amt0, amt1)),
+			"asset_in": "HIVE",
+			"asset_out": "HBD",
+			"recipient": "hive:bob",
+			"amount_in": 100000,
+			"slippage_bps": 500,
+			"metadata": {"min_lp_out": 68000}
+		}`)),
 		RcLimit: 10000,
 		Intents: intents,
-		Caller:  "hive:alice",
+		Caller:  "hive:bob",
+	})
+
+	assert.True(t, result.Success)
+
+	// Part of the HIVE is swapped to HBD and deposited straight back, so the
+	// HBD reserve is unchanged. 3 HIVE of rounding remainder is not drawn.
+	assert.Equal(t, `"2000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"1099957"`, ct.StateGet(contractId, "pool/1/reserve1"))
+	assert.Equal(t, `"68996"`, ct.StateGet(contractId, "pool/1/lp/hive:bob"))
+	assert.Equal(t, `"1483209"`, ct.StateGet(contractId, "pool/1/total_lp"))
+}
+
+func TestSingleAssetWithdrawal(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	addLiquidityForPair(&ct, contractId, "HBD", "HIVE", 2000000, 1000000)
+
+	withdraw := func(txId string, minAmountOut uint64) stateEngine.TxResult {
+		result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+			Self: stateEngine.TxSelf{
+				TxId:                 txId,
+				BlockId:              "block:" + txId,
+				Index:                3,
+				OpIndex:              0,
+				Timestamp:            "2025-01-01T00:02:00Z",
+				RequiredAuths:        []string{"hive:alice"},
+				RequiredPostingAuths: []string{},
+			},
+			ContractId: contractId,
+			Action:     "execute",
+			Payload: json.RawMessage(fmt.Sprintf(`{
+				"type": "withdrawal",
+				"version": "1.0.0",
+				"asset_in": "HIVE",
+				"asset_out": "HBD",
+				"recipient": "hive:alice",
+				"min_amount_out": %d,
+				"metadata": {"lp_amount": 141421, "single_asset": true}
+			}`, minAmountOut)),
+			RcLimit: 10000,
+			Intents: []contracts.Intent{},
+			Caller:  "hive:alice",
+		})
+		return result
+	}
+
+	// 10% of the supply redeems 199999 HBD and 99999 HIVE. The HIVE is swapped
+	// at the post-withdrawal reserves: 99919 * 1800001 / 1000920 = 179868 HBD,
+	// for 379867 HBD in total.
+	result := withdraw("single_withdraw_strict_tx", 400000)
+	assertError(t, result, "E_MIN_OUTPUT", "output below min_amount_out")
+	assert.Equal(t, `"2000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+
+	result = withdraw("single_withdraw_tx", 379000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1620133"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"999920"`, ct.StateGet(contractId, "pool/1/reserve1"))
+	assert.Equal(t, `"1271792"`, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+	assert.Equal(t, `"80"`, ct.StateGet(contractId, "pool/1/fee1"))
+}
+
+func TestWithdrawalAuthorization(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	addLiquidityForPair(&ct, contractId, "HBD", "HIVE", 2000000, 1000000)
+	lp := ct.StateGet(contractId, "pool/1/lp/hive:alice")
+
+	withdraw := func(txId, sender, caller, metadata string) stateEngine.TxResult {
+		return callAsForTest(&ct, contractId, txId, sender, caller, "execute", `{
+			"type": "withdrawal",
+			"version": "1.0.0",
+			"asset_in": "HIVE",
+			"asset_out": "HBD",
+			"recipient": "hive:alice",
+			"metadata": `+metadata+`
+		}`)
+	}
+
+	// A third party cannot burn alice's LP, whether plainly or single-asset,
+	// and neither can a contract she calls through
+	result := withdraw("auth_plain_bob_tx", "hive:bob", "hive:bob", `{"lp_amount": 1000}`)
+	assertError(t, result, "E_UNAUTHORIZED", "only the LP holder can withdraw")
+	result = withdraw("auth_single_bob_tx", "hive:bob", "hive:bob", `{"lp_amount": 1000, "single_asset": true}`)
+	assertError(t, result, "E_UNAUTHORIZED", "only the LP holder can withdraw")
+	result = withdraw("auth_contract_tx", "hive:alice", "contract:vault", `{"lp_amount": 1000}`)
+	assertError(t, result, "E_UNAUTHORIZED", "only the LP holder can withdraw")
+	assert.Equal(t, lp, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+	assert.Equal(t, `"2000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+
+	// lp_amount must be a whole LP amount, rejected before the holder check
+	result = withdraw("auth_negative_tx", "hive:alice", "hive:alice", `{"lp_amount": -1}`)
+	assertError(t, result, "E_INVALID_PARAM", "lp_amount must be a non-negative integer")
+	result = withdraw("auth_fraction_tx", "hive:bob", "hive:bob", `{"lp_amount": 0.5, "single_asset": true}`)
+	assertError(t, result, "E_INVALID_PARAM", "lp_amount must be a non-negative integer")
+	result = withdraw("auth_huge_tx", "hive:alice", "hive:alice", `{"lp_amount": 1e20}`)
+	assertError(t, result, "E_INVALID_PARAM", "lp_amount must be a non-negative integer")
+	assert.Equal(t, lp, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+
+	// Alice withdraws her own
+	result = withdraw("auth_plain_alice_tx", "hive:alice", "hive:alice", `{"lp_amount": 1000}`)
+	assert.True(t, result.Success)
+	assert.NotEqual(t, lp, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+}
+
+// Helper functions
+
+func TestLpTransferAndAllowance(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	result := depositForTest(&ct, contractId, "lp_deposit_tx", "hive:alice", "HBD", "HIVE", 2000000, 1000000)
+	assert.True(t, result.Success)
+
+	// The sender moves its own LP
+	result = callAsForTest(&ct, contractId, "transfer_lp_tx", "hive:alice", "hive:alice", "transfer_lp",
+		`{"pool_id": "1", "to": "hive:bob", "amount": 1000}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1412213"`, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+	assert.Equal(t, `"1000"`, ct.StateGet(contractId, "pool/1/lp/hive:bob"))
+
+	result = callAsForTest(&ct, contractId, "transfer_lp_over_tx", "hive:bob", "hive:bob", "transfer_lp",
+		`{"pool_id": "1", "to": "hive:bob2", "amount": 1001}`)
+	assertError(t, result, "E_INSUFFICIENT_LP", "insufficient LP balance")
+
+	// A vault contract moves LP on alice's behalf up to its allowance
+	result = callAsForTest(&ct, contractId, "approve_lp_tx", "hive:alice", "hive:alice", "approve_lp",
+		`{"pool_id": "1", "spender": "contract:vault", "amount": 500}`)
+	assert.True(t, result.Success)
+
+	result = callAsForTest(&ct, contractId, "transfer_from_over_tx", "hive:alice", "contract:vault", "transfer_lp_from",
+		`{"pool_id": "1", "from": "hive:alice", "to": "contract:vault", "amount": 600}`)
+	assertError(t, result, "E_INSUFFICIENT_ALLOWANCE", "insufficient allowance")
+
+	result = callAsForTest(&ct, contractId, "transfer_from_tx", "hive:alice", "contract:vault", "transfer_lp_from",
+		`{"pool_id": "1", "from": "hive:alice", "to": "contract:vault", "amount": 400}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"400"`, ct.StateGet(contractId, "pool/1/lp/contract:vault"))
+	assert.Equal(t, `"100"`, ct.StateGet(contractId, "pool/1/allowance/hive:alice/contract:vault"))
+
+	// The allowance belongs to the vault, not to other callers
+	result = callAsForTest(&ct, contractId, "transfer_from_bob_tx", "hive:bob", "hive:bob", "transfer_lp_from",
+		`{"pool_id": "1", "from": "hive:alice", "to": "hive:bob", "amount": 100}`)
+	assertError(t, result, "E_INSUFFICIENT_ALLOWANCE", "insufficient allowance")
+
+	// The contract holds the position and can release it
+	result = callAsForTest(&ct, contractId, "vault_release_tx", "hive:alice", "contract:vault", "transfer_lp",
+		`{"pool_id": "1", "to": "hive:alice", "amount": 400}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"0"`, ct.StateGet(contractId, "pool/1/lp/contract:vault"))
+	assert.Equal(t, `"1412213"`, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+}
+
+func TestPoolAdministration(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	// The init signer owns the contract and cannot be replaced by a re-init
+	setupDexTest(&ct, contractId)
+	assert.Equal(t, `"hive:alice"`, ct.StateGet(contractId, "owner"))
+	result := callAsForTest(&ct, contractId, "reinit_tx", "hive:bob", "hive:bob", "init", `"1.0.0"`)
+	assertError(t, result, "E_ALREADY_INITIALIZED", "already initialized")
+
+	result = depositForTest(&ct, contractId, "admin_deposit_tx", "hive:alice", "HBD", "HIVE", 2000000, 1000000)
+	assert.True(t, result.Success)
+
+	result = callAsForTest(&ct, contractId, "bob_fee_tx", "hive:bob", "hive:bob", "set_pool_fee", `{"pool_id": "1", "fee_bps": 30}`)
+	assertError(t, result, "E_UNAUTHORIZED", "admin only")
+
+	result = callAsForTest(&ct, contractId, "owner_fee_tx", "hive:alice", "hive:alice", "set_pool_fee", `{"pool_id": "1", "fee_bps": 30}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"30"`, ct.StateGet(contractId, "pool/1/fee"))
+
+	// An admin appointed by the owner can pause the pool
+	result = callAsForTest(&ct, contractId, "set_admin_tx", "hive:alice", "hive:alice", "set_admin", `{"address": "hive:bob", "enabled": true}`)
+	assert.True(t, result.Success)
+	result = callAsForTest(&ct, contractId, "pause_tx", "hive:bob", "hive:bob", "pause_pool", `"1"`)
+	assert.True(t, result.Success)
+
+	// Paused pools reject swaps and deposits but still let providers exit
+	result = swapForTest(&ct, contractId, "paused_swap_tx", "hive:bob", "HBD", "HIVE", 10000)
+	assertError(t, result, "E_POOL_PAUSED", "pool paused")
+	result = depositForTest(&ct, contractId, "paused_deposit_tx", "hive:alice", "HBD", "HIVE", 2000, 1000)
+	assertError(t, result, "E_POOL_PAUSED", "pool paused")
+	result = callAsForTest(&ct, contractId, "paused_single_withdraw_tx", "hive:alice", "hive:alice", "execute", `{
+		"type": "withdrawal",
+		"version": "1.0.0",
+		"asset_in": "HIVE",
+		"asset_out": "HBD",
+		"recipient": "hive:alice",
+		"metadata": {"lp_amount": 1000, "single_asset": true}
+	}`)
+	assertError(t, result, "E_POOL_PAUSED", "pool paused, single-asset withdrawals disabled; withdraw proportionally")
+	lp := ct.StateGet(contractId, "pool/1/lp/hive:alice")
+	result = withdrawForTest(&ct, contractId, "paused_withdraw_tx", "hive:alice", "HBD", "HIVE", 1000)
+	assert.True(t, result.Success)
+	assert.NotEqual(t, lp, ct.StateGet(contractId, "pool/1/lp/hive:alice"))
+
+	result = callAsForTest(&ct, contractId, "unpause_tx", "hive:bob", "hive:bob", "unpause_pool", `"1"`)
+	assert.True(t, result.Success)
+	result = swapForTest(&ct, contractId, "unpaused_swap_tx", "hive:bob", "HBD", "HIVE", 10000)
+	assert.True(t, result.Success)
+
+	// Admins cannot move ownership; the owner can
+	result = callAsForTest(&ct, contractId, "bob_owner_tx", "hive:bob", "hive:bob", "transfer_ownership", `"hive:bob"`)
+	assertError(t, result, "E_UNAUTHORIZED", "owner only")
+	result = callAsForTest(&ct, contractId, "owner_transfer_tx", "hive:alice", "hive:alice", "transfer_ownership", `"hive:carol"`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"hive:carol"`, ct.StateGet(contractId, "owner"))
+	result = callAsForTest(&ct, contractId, "old_owner_admin_tx", "hive:alice", "hive:alice", "set_admin", `{"address": "hive:dave", "enabled": true}`)
+	assertError(t, result, "E_UNAUTHORIZED", "owner only")
+}
+
+func TestMigrateOwnerlessDeployment(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	// State left by an init that predates the contract owner
+	ct.StateSet(contractId, "version", `"1.0.0"`)
+	ct.StateSet(contractId, "next_pool_id", `"1"`)
+
+	result := callAsForTest(&ct, contractId, "takeover_init_tx", "hive:bob", "hive:bob", "init", `"1.0.0"`)
+	assertError(t, result, "E_ALREADY_INITIALIZED", "already initialized")
+	assert.Equal(t, "", ct.StateGet(contractId, "owner"))
+
+	result = callAsForTest(&ct, contractId, "bob_migrate_tx", "hive:bob", "hive:bob", "migrate", "")
+	assertError(t, result, "E_UNAUTHORIZED", "deployment owner only")
+
+	// The deployment owner takes ownership and gets the default assets
+	result = callAsForTest(&ct, contractId, "migrate_tx", "hive:alice", "hive:alice", "migrate", "")
+	assert.True(t, result.Success)
+	assert.Equal(t, `"hive:alice"`, ct.StateGet(contractId, "owner"))
+	assert.Equal(t, `"3"`, ct.StateGet(contractId, "asset/HBD/decimals"))
+	assert.Equal(t, `"3"`, ct.StateGet(contractId, "asset/HIVE/decimals"))
+
+	result = callAsForTest(&ct, contractId, "remigrate_tx", "hive:alice", "hive:alice", "migrate", "")
+	assertError(t, result, "E_ALREADY_INITIALIZED", "already migrated")
+
+	// A fresh deployment runs init instead
+	ct.RegisterContract("dex_router_fresh", "hive:alice", contractWasm(t))
+	result = callAsForTest(&ct, "dex_router_fresh", "fresh_migrate_tx", "hive:alice", "hive:alice", "migrate", "")
+	assertError(t, result, "E_INVALID_PARAM", "not initialized, run init")
+}
+
+func TestAssetRegistry(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+
+	// Unknown assets cannot be pooled until an admin registers them
+	result := callAsForTest(&ct, contractId, "create_eth_tx", "hive:bob", "hive:bob", "create_pool",
+		`{"asset0": "ETH", "asset1": "HIVE"}`)
+	assertError(t, result, "E_UNKNOWN_ASSET", "unknown asset ETH")
+
+	result = callAsForTest(&ct, contractId, "bob_register_tx", "hive:bob", "hive:bob", "register_asset",
+		`{"symbol": "ETH", "decimals": 18}`)
+	assertError(t, result, "E_UNAUTHORIZED", "admin only")
+
+	result = callAsForTest(&ct, contractId, "register_eth_tx", "hive:alice", "hive:alice", "register_asset",
+		`{"symbol": "ETH", "decimals": 18}`)
+	assert.True(t, result.Success)
+	result = callAsForTest(&ct, contractId, "create_eth_retry_tx", "hive:bob", "hive:bob", "create_pool",
+		`{"asset0": "ETH", "asset1": "HIVE"}`)
+	assert.True(t, result.Success)
+
+	// Disabling an asset stops trading but leaves withdrawals open
+	result = depositForTest(&ct, contractId, "registry_deposit_tx", "hive:alice", "HBD", "HIVE", 2000000, 1000000)
+	assert.True(t, result.Success)
+	result = callAsForTest(&ct, contractId, "disable_hbd_tx", "hive:alice", "hive:alice", "set_asset_enabled",
+		`{"symbol": "HBD", "enabled": false}`)
+	assert.True(t, result.Success)
+
+	result = swapForTest(&ct, contractId, "disabled_swap_tx", "hive:bob", "HBD", "HIVE", 10000)
+	assertError(t, result, "E_ASSET_DISABLED", "asset HBD disabled")
+	result = swapForTest(&ct, contractId, "unknown_swap_tx", "hive:bob", "HIVE", "DOGE", 10000)
+	assertError(t, result, "E_UNKNOWN_ASSET", "unknown asset DOGE")
+	result = withdrawForTest(&ct, contractId, "disabled_withdraw_tx", "hive:alice", "HBD", "HIVE", 1000)
+	assert.True(t, result.Success)
+
+	result = callAsForTest(&ct, contractId, "get_hbd_tx", "hive:bob", "hive:bob", "get_asset", `"HBD"`)
+	assert.JSONEq(t, `{"symbol": "HBD", "decimals": 3, "enabled": false}`, result.Ret)
+}
+
+func TestFeeTiers(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	// Pool 1 is HBD/HIVE at 8 bps; add the same pair at 30 bps
+	setupDexTest(&ct, contractId)
+	result := callAsForTest(&ct, contractId, "create_tier_tx", "hive:alice", "hive:alice", "create_pool",
+		`{"asset0": "HIVE", "asset1": "HBD", "fee_bps": 30}`)
+	assert.True(t, result.Success)
+	result = callAsForTest(&ct, contractId, "create_tier_dup_tx", "hive:alice", "hive:alice", "create_pool",
+		`{"asset0": "HBD", "asset1": "HIVE", "fee_bps": 30}`)
+	assertError(t, result, "E_POOL_EXISTS", "pool already exists for pair")
+	assert.Equal(t, `"2"`, ct.StateGet(contractId, "pair/HBD/HIVE/30"))
+	assert.Equal(t, `"8,30"`, ct.StateGet(contractId, "pair/HBD/HIVE/tiers"))
+
+	// Liquidity instructions must name the tier once a pair has several
+	result = depositForTest(&ct, contractId, "tier_ambiguous_tx", "hive:alice", "HBD", "HIVE", 1000000, 1000000)
+	assertError(t, result, "E_FEE_TIER_REQUIRED", "multiple fee tiers for pair, fee_bps required")
+
+	for _, fee := range []int{8, 30} {
+		txId := fmt.Sprintf("tier_deposit_%d_tx", fee)
+		result = executeForTest(&ct, contractId, txId, "hive:alice", fmt.Sprintf(`{
+			"type": "deposit",
+			"version": "1.0.0",
+			"asset_in": "HBD",
+			"asset_out": "HIVE",
+			"recipient": "hive:alice",
+			"fee_bps": %d,
+			"metadata": {"amount0": 1000000, "amount1": 1000000}
+		}`, fee), map[string]int64{"HBD": 1000000, "HIVE": 1000000})
+		assert.True(t, result.Success)
+	}
+
+	// Unpinned, the swap takes the tier with the best output: 8 bps
+	result = swapForTest(&ct, contractId, "tier_best_swap_tx", "hive:bob", "HBD", "HIVE", 10000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1009992"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"1000000"`, ct.StateGet(contractId, "pool/2/reserve1"))
+
+	// Pinned, it uses the 30 bps pool even though it pays less
+	result = executeForTest(&ct, contractId, "tier_pinned_swap_tx", "hive:bob", `{
+		"type": "swap",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "hive:bob",
+		"amount_in": 10000,
+		"fee_bps": 30
+	}`, map[string]int64{"HBD": 10000})
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1009970"`, ct.StateGet(contractId, "pool/2/reserve1"))
+
+	// Moving a pool to an occupied tier is rejected
+	result = callAsForTest(&ct, contractId, "tier_fee_clash_tx", "hive:alice", "hive:alice", "set_pool_fee",
+		`{"pool_id": "1", "fee_bps": 30}`)
+	assertError(t, result, "E_POOL_EXISTS", "fee tier already exists for pair")
+	result = callAsForTest(&ct, contractId, "tier_fee_move_tx", "hive:alice", "hive:alice", "set_pool_fee",
+		`{"pool_id": "1", "fee_bps": 5}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"5,30"`, ct.StateGet(contractId, "pair/HBD/HIVE/tiers"))
+	assert.Equal(t, `"1"`, ct.StateGet(contractId, "pair/HBD/HIVE/5"))
+}
+
+func TestTwapOracle(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	// 1 HBD = 2 HIVE from block 0
+	setupDexTest(&ct, contractId)
+	result := depositForTest(&ct, contractId, "twap_deposit_tx", "hive:alice", "HBD", "HIVE", 1000000, 2000000)
+	assert.True(t, result.Success)
+
+	var twap struct {
+		FromBlock uint64 `json:"from_block"`
+		Price0X64 string `json:"price0_x64"`
+		Price1X64 string `json:"price1_x64"`
+	}
+	ct.IncrementBlocks(10)
+	result = callAsForTest(&ct, contractId, "twap_query_1", "hive:bob", "hive:bob", "get_twap", `{"pool_id": "1", "window": 10}`)
+	assert.True(t, result.Success)
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &twap))
+	assert.Equal(t, uint64(0), twap.FromBlock)
+	assert.Equal(t, "36893488147419103232", twap.Price0X64) // 2.0 in 64.64
+	assert.Equal(t, "9223372036854775808", twap.Price1X64)  // 0.5
+
+	// A swap moves the price to 3998400/500201; the accumulator records the
+	// ten blocks spent at the old price before the reserves change
+	result = swapForTest(&ct, contractId, "twap_swap_tx", "hive:bob", "HIVE", "HBD", 2000000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"368934881474191032320"`, ct.StateGet(contractId, "pool/1/price0_cumulative"))
+
+	// Ten blocks at each price average to about 5 HIVE per HBD
+	ct.IncrementBlocks(10)
+	result = callAsForTest(&ct, contractId, "twap_query_2", "hive:bob", "hive:bob", "get_twap", `{"pool_id": "1", "window": 20}`)
+	assert.True(t, result.Success)
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &twap))
+	assert.Equal(t, "92174566993216181132", twap.Price0X64)
+
+	result = callAsForTest(&ct, contractId, "twap_query_3", "hive:bob", "hive:bob", "get_twap", `{"pool_id": "1", "window": 21}`)
+	assertError(t, result, "E_INVALID_PARAM", "invalid window")
+}
+
+func TestStableSwapPool(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	// Pool 1 is the constant-product HBD/HIVE pool; pool 2 a stable one at 4 bps
+	setupDexTest(&ct, contractId)
+	result := callAsForTest(&ct, contractId, "stable_bad_type_tx", "hive:alice", "hive:alice", "create_pool",
+		`{"asset0": "HBD", "asset1": "HIVE", "fee_bps": 4, "type": "weighted"}`)
+	assertError(t, result, "E_INVALID_PARAM", "unknown pool type")
+	result = callAsForTest(&ct, contractId, "stable_bad_amp_tx", "hive:alice", "hive:alice", "create_pool",
+		`{"asset0": "HBD", "asset1": "HIVE", "fee_bps": 4, "type": "stableswap", "amp": 0}`)
+	assertError(t, result, "E_INVALID_PARAM", "amp must be between 1 and 1000000")
+	result = callAsForTest(&ct, contractId, "stable_cp_amp_tx", "hive:alice", "hive:alice", "create_pool",
+		`{"asset0": "HBD", "asset1": "HIVE", "fee_bps": 4, "amp": 100}`)
+	assertError(t, result, "E_INVALID_PARAM", "amp only applies to stableswap pools")
+	result = callAsForTest(&ct, contractId, "stable_create_tx", "hive:alice", "hive:alice", "create_pool",
+		`{"asset0": "HBD", "asset1": "HIVE", "fee_bps": 4, "type": "stableswap", "amp": 100}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"stableswap"`, ct.StateGet(contractId, "pool/2/type"))
+	assert.Equal(t, `"100"`, ct.StateGet(contractId, "pool/2/amp"))
+
+	// The first deposit mints D, which is the sum of balanced reserves
+	result = executeForTest(&ct, contractId, "stable_deposit_tx", "hive:alice", `{
+		"type": "deposit",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "hive:alice",
+		"fee_bps": 4,
+		"metadata": {"amount0": 1000000, "amount1": 1000000}
+	}`, map[string]int64{"HBD": 1000000, "HIVE": 1000000})
+	assert.True(t, result.Success)
+	assert.Equal(t, `"2000000"`, ct.StateGet(contractId, "pool/2/total_lp"))
+
+	// Quotes and swaps follow the curve: 100000 HBD buys 99909 HIVE where
+	// constant product would give 90876
+	result = callAsForTest(&ct, contractId, "stable_quote_tx", "hive:bob", "hive:bob", "get_quote", `{
+		"type": "swap",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "hive:bob",
+		"amount_in": 100000
+	}`)
+	assert.True(t, result.Success)
+	var quote struct {
+		AmountOut uint64 `json:"amount_out"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &quote))
+	assert.Equal(t, uint64(99909), quote.AmountOut)
+
+	result = swapForTest(&ct, contractId, "stable_swap_tx", "hive:bob", "HBD", "HIVE", 100000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1099960"`, ct.StateGet(contractId, "pool/2/reserve0"))
+	assert.Equal(t, `"900091"`, ct.StateGet(contractId, "pool/2/reserve1"))
+
+	// A single-sided deposit joins the pool whole, less the imbalance fee
+	result = executeForTest(&ct, contractId, "stable_zap_tx", "hive:bob", `{
+		"type": "deposit",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "hive:bob",
+		"amount_in": 100000,
+		"fee_bps": 4
+	}`, map[string]int64{"HBD": 100000})
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1199960"`, ct.StateGet(contractId, "pool/2/reserve0"))
+	assert.Equal(t, `"99925"`, ct.StateGet(contractId, "pool/2/lp/hive:bob"))
+
+	var pool struct {
+		Type string `json:"type"`
+		Amp  uint64 `json:"amp"`
+	}
+	result = callAsForTest(&ct, contractId, "stable_get_pool_tx", "hive:bob", "hive:bob", "get_pool", `"2"`)
+	assert.True(t, result.Success)
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &pool))
+	assert.Equal(t, "stableswap", pool.Type)
+	assert.Equal(t, uint64(100), pool.Amp)
+}
+
+func TestTransferIntentLimits(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	depositForTest(&ct, contractId, "intent_seed_tx", "hive:alice", "HBD", "HIVE", 1000000, 1000000)
+
+	swap := `{
+		"type": "swap",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "hive:bob",
+		"amount_in": 100000
+	}`
+
+	// No intent, a limit below the amount and an intent for the wrong token
+	// are all rejected before anything is drawn
+	result := executeForTest(&ct, contractId, "intent_none_tx", "hive:bob", swap, nil)
+	assertError(t, result, "E_INTENT_MISSING", "no transfer.allow intent for HBD")
+	result = executeForTest(&ct, contractId, "intent_low_tx", "hive:bob", swap, map[string]int64{"HBD": 99999})
+	assertError(t, result, "E_INTENT_EXCEEDED", "HBD amount 100000 exceeds transfer.allow limit 99999")
+	result = executeForTest(&ct, contractId, "intent_token_tx", "hive:bob", swap, map[string]int64{"HIVE": 100000})
+	assertError(t, result, "E_INTENT_MISSING", "no transfer.allow intent for HBD")
+	assert.Equal(t, `"1000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+
+	// Deposits check both sides
+	result = executeForTest(&ct, contractId, "intent_deposit_tx", "hive:bob", `{
+		"type": "deposit",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "hive:bob",
+		"metadata": {"amount0": 100000, "amount1": 100000}
+	}`, map[string]int64{"HBD": 100000})
+	assertError(t, result, "E_INTENT_MISSING", "no transfer.allow intent for HIVE")
+	assert.Equal(t, "", ct.StateGet(contractId, "pool/1/lp/hive:bob"))
+
+	// A limit at or above the amount lets the swap through
+	result = executeForTest(&ct, contractId, "intent_ok_tx", "hive:bob", swap, map[string]int64{"HBD": 100000})
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1100000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+
+	// BTC limits are written with three decimals like every other asset, as
+	// the host ledger parses them, so a limit in BTC's own 8 decimals is
+	// unreadable
+	result = callAsForTest(&ct, contractId, "intent_btc_pool_tx", "hive:alice", "hive:alice", "create_pool",
+		`{"asset0": "BTC", "asset1": "HIVE", "fee_bps": 8}`)
+	assert.True(t, result.Success)
+	btcDeposit := `{
+		"type": "deposit",
+		"version": "1.0.0",
+		"asset_in": "BTC",
+		"asset_out": "HIVE",
+		"recipient": "hive:bob",
+		"metadata": {"amount0": 100000, "amount1": 100000}
+	}`
+	result, _, _ = ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "intent_btc_bad_tx",
+			BlockId:              "block:intent_btc_bad_tx",
+			Index:                14,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:07:00Z",
+			RequiredAuths:        []string{"hive:bob"},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "execute",
+		Payload:    json.RawMessage([]byte(btcDeposit)),
+		RcLimit:    10000,
+		Intents: []contracts.Intent{
+			{Type: "transfer.allow", Args: map[string]string{"token": "BTC", "limit": "0.00100000"}},
+			allowIntent("HIVE", 100000),
+		},
+		Caller: "hive:bob",
+	})
+	assertError(t, result, "E_INTENT_INVALID", "invalid transfer.allow limit for BTC")
+
+	result = executeForTest(&ct, contractId, "intent_btc_ok_tx", "hive:bob", btcDeposit, map[string]int64{"BTC": 100000, "HIVE": 100000})
+	assert.True(t, result.Success)
+	assert.Equal(t, "100.000", allowIntent("BTC", 100000).Args["limit"])
+}
+
+func TestSwapDeadline(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	depositForTest(&ct, contractId, "deadline_seed_tx", "hive:alice", "HBD", "HIVE", 1000000, 1000000)
+	ct.IncrementBlocks(10)
+
+	swap := func(txId, deadline string) stateEngine.TxResult {
+		return executeForTest(&ct, contractId, txId, "hive:bob", `{
+			"type": "swap",
+			"version": "1.0.0",
+			"asset_in": "HBD",
+			"asset_out": "HIVE",
+			"recipient": "hive:bob",
+			"amount_in": 100000,
+			"deadline": `+deadline+`
+		}`, map[string]int64{"HBD": 100000})
+	}
+
+	// Past either bound the instruction reverts without touching the pool;
+	// executeForTest runs at 2025-01-01T00:07:00Z
+	result := swap("deadline_height_tx", `{"block_height": 5}`)
+	assert.False(t, result.Success)
+	result = swap("deadline_time_tx", `{"timestamp": "2025-01-01T00:06:00Z"}`)
+	assert.False(t, result.Success)
+	result = swap("deadline_both_tx", `{"block_height": 100, "timestamp": "2025-01-01T00:06:00Z"}`)
+	assert.False(t, result.Success)
+	assert.Equal(t, `"1000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+
+	result = swap("deadline_empty_tx", `{}`)
+	assertError(t, result, "E_INVALID_PARAM", "invalid deadline")
+
+	// The timestamp bound is inclusive
+	result = swap("deadline_ok_tx", `{"block_height": 100, "timestamp": "2025-01-01T00:07:00Z"}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1100000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+}
+
+func TestSwapRefund(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	depositForTest(&ct, contractId, "refund_seed_tx", "hive:alice", "HBD", "HIVE", 1000000, 1000000)
+
+	swap := func(txId, assetIn, fields string) stateEngine.TxResult {
+		return executeForTest(&ct, contractId, txId, "hive:bob", `{
+			"type": "swap",
+			"version": "1.0.0",
+			"asset_in": "`+assetIn+`",
+			"asset_out": "HIVE",
+			"recipient": "hive:bob",
+			"amount_in": 100000,
+			`+fields+`
+		}`, map[string]int64{assetIn: 100000})
+	}
+	var envelope struct {
+		Events []struct {
+			Type    string `json:"type"`
+			Asset   string `json:"asset"`
+			Amount  uint64 `json:"amount"`
+			Chain   string `json:"chain"`
+			Address string `json:"address"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"events"`
+	}
+	refunded := func(result stateEngine.TxResult, reason, message string) {
+		assert.True(t, result.Success)
+		assert.NoError(t, json.Unmarshal([]byte(result.Ret), &envelope))
+		assert.Len(t, envelope.Events, 1)
+		event := envelope.Events[0]
+		assert.Equal(t, "swap_refunded", event.Type)
+		assert.Equal(t, "HBD", event.Asset)
+		assert.Equal(t, uint64(100000), event.Amount)
+		assert.Equal(t, "HIVE", event.Chain)
+		assert.Equal(t, "hive:carol", event.Address)
+		assert.Equal(t, reason, event.Reason)
+		assert.Equal(t, message, event.Message)
+	}
+	returnTo := `"return_address": {"chain": "HIVE", "address": "hive:carol"}`
+
+	// Without a return address an unfillable swap just fails
+	result := swap("refund_none_tx", "HBD", `"fee_bps": 30`)
+	assertError(t, result, "E_POOL_NOT_FOUND", "no pool found for HBD/HIVE")
+
+	// No pool at the tier, output below the floor and slippage beyond the
+	// tolerance are refunded to the return address without touching the pool
+	refunded(swap("refund_pool_tx", "HBD", `"fee_bps": 30, `+returnTo), "E_POOL_NOT_FOUND", "no pool found for HBD/HIVE")
+	refunded(swap("refund_floor_tx", "HBD", `"min_amount_out": 100000, `+returnTo), "E_MIN_OUTPUT", "output below min_amount_out")
+	refunded(swap("refund_slippage_tx", "HBD", `"slippage_bps": 1, `+returnTo), "E_SLIPPAGE", "slippage tolerance exceeded")
+
+	// So are swaps rejected before routing: expired, or naming an unknown or
+	// disabled asset
+	refunded(swap("refund_expired_tx", "HBD", `"deadline": {"block_height": 5}, `+returnTo), "E_EXPIRED", "instruction deadline passed")
+	refunded(swap("refund_unknown_tx", "HBD", `"path": ["HBD", "DOGE", "HIVE"], `+returnTo), "E_UNKNOWN_ASSET", "unknown asset DOGE")
+	result = callAsForTest(&ct, contractId, "refund_disable_hbd_tx", "hive:alice", "hive:alice", "set_asset_enabled",
+		`{"symbol": "HBD", "enabled": false}`)
+	assert.True(t, result.Success)
+	refunded(swap("refund_disabled_tx", "HBD", returnTo), "E_ASSET_DISABLED", "asset HBD disabled")
+	result = swap("refund_disabled_none_tx", "HBD", `"min_amount_out": 0`)
+	assertError(t, result, "E_ASSET_DISABLED", "asset HBD disabled")
+	result = callAsForTest(&ct, contractId, "refund_enable_hbd_tx", "hive:alice", "hive:alice", "set_asset_enabled",
+		`{"symbol": "HBD", "enabled": true}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"1000000"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"1000000"`, ct.StateGet(contractId, "pool/1/reserve1"))
+
+	// BTC refunds go through the registered mapping contract and only refund BTC
+	btcReturn := `"return_address": {"chain": "BTC", "address": "bc1qxy2kgdygjrsqtzq2n0yrf2493p83kkfjhx0wlh"}`
+	result = swap("refund_btc_asset_tx", "HBD", btcReturn)
+	assertError(t, result, "E_RETURN_ADDRESS", "BTC return_address only refunds BTC")
+	result = swap("refund_btc_unmapped_tx", "BTC", btcReturn)
+	assertError(t, result, "E_REFUND_UNAVAILABLE", "no BTC mapping contract to refund through: no direct pool found, path required")
+
+	result = callAsForTest(&ct, contractId, "refund_set_mapping_bob_tx", "hive:bob", "hive:bob", "set_mapping_contract",
+		`{"chain": "BTC", "contract_id": "btc_mapping"}`)
+	assertError(t, result, "E_UNAUTHORIZED", "admin only")
+	result = callAsForTest(&ct, contractId, "refund_set_mapping_eth_tx", "hive:alice", "hive:alice", "set_mapping_contract",
+		`{"chain": "ETH", "contract_id": "eth_mapping"}`)
+	assertError(t, result, "E_INVALID_PARAM", "unsupported chain ETH")
+	result = callAsForTest(&ct, contractId, "refund_set_mapping_tx", "hive:alice", "hive:alice", "set_mapping_contract",
+		`{"chain": "BTC", "contract_id": "btc_mapping"}`)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"btc_mapping"`, ct.StateGet(contractId, "mapping/BTC"))
+}
+
+func TestSwapRefundBtc(t *testing.T) {
+	mappingWasm := wasmForTest(t, "mapping.wasm", "tinygo build -o artifacts/mapping.wasm -target wasm ./testdata/mapping")
+
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+	ct.RegisterContract("btc_mapping", "hive:alice", mappingWasm)
+
+	setupDexTest(&ct, contractId)
+	depositForTest(&ct, contractId, "refund_btc_seed_tx", "hive:alice", "HBD", "HIVE", 1000000, 1000000)
+
+	btcAddress := "bc1qxy2kgdygjrsqtzq2n0yrf2493p83kkfjhx0wlh"
+	swap := func(txId string) stateEngine.TxResult {
+		return executeForTest(&ct, contractId, txId, "hive:bob", `{
+			"type": "swap",
+			"version": "1.0.0",
+			"asset_in": "BTC",
+			"asset_out": "HIVE",
+			"recipient": "hive:bob",
+			"amount_in": 100000,
+			"return_address": {"chain": "BTC", "address": "`+btcAddress+`"}
+		}`, map[string]int64{"BTC": 100000})
+	}
+
+	// With no mapping contract configured nothing is drawn or unmapped
+	result := swap("refund_btc_none_tx")
+	assertError(t, result, "E_REFUND_UNAVAILABLE", "no BTC mapping contract to refund through: no direct pool found, path required")
+	assert.Equal(t, "", ct.StateGet("btc_mapping", "unmapped/"+btcAddress))
+
+	// Once registered, the refund is unmapped through it to the Bitcoin address
+	result = callAsForTest(&ct, contractId, "refund_btc_set_mapping_tx", "hive:alice", "hive:alice", "set_mapping_contract",
+		`{"chain": "BTC", "contract_id": "btc_mapping"}`)
+	assert.True(t, result.Success)
+
+	result = swap("refund_btc_tx")
+	assert.True(t, result.Success)
+	var envelope struct {
+		Events []struct {
+			Type    string `json:"type"`
+			Asset   string `json:"asset"`
+			Amount  uint64 `json:"amount"`
+			Chain   string `json:"chain"`
+			Address string `json:"address"`
+			Reason  string `json:"reason"`
+		} `json:"events"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &envelope))
+	assert.Len(t, envelope.Events, 1)
+	assert.Equal(t, "swap_refunded", envelope.Events[0].Type)
+	assert.Equal(t, "BTC", envelope.Events[0].Asset)
+	assert.Equal(t, uint64(100000), envelope.Events[0].Amount)
+	assert.Equal(t, "BTC", envelope.Events[0].Chain)
+	assert.Equal(t, btcAddress, envelope.Events[0].Address)
+	assert.Equal(t, "E_POOL_NOT_FOUND", envelope.Events[0].Reason)
+	assert.Equal(t, `"100000"`, ct.StateGet("btc_mapping", "unmapped/"+btcAddress))
+}
+
+func TestClaimFees(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	depositForTest(&ct, contractId, "claim_seed_tx", "hive:alice", "HBD", "HIVE", 1000000, 1000000)
+	result := swapForTest(&ct, contractId, "claim_swap_tx", "hive:bob", "HBD", "HIVE", 100000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"80"`, ct.StateGet(contractId, "pool/1/fee0"))
+
+	// Only the system account claims, and not within a day of pool creation
+	result = callAsForTest(&ct, contractId, "claim_bob_tx", "hive:bob", "hive:bob", "claim_fees", `"1"`)
+	assertError(t, result, "E_UNAUTHORIZED", "system only")
+	result = callAsForTest(&ct, contractId, "claim_early_tx", "system:consensus", "system:consensus", "claim_fees", `"1"`)
+	assertError(t, result, "E_CLAIM_INTERVAL", "fees already claimed, next claim at 2025-01-02T00:00:01Z")
+
+	var unclaimed struct {
+		Pools []struct {
+			PoolId    string `json:"pool_id"`
+			Fee0      uint64 `json:"fee0"`
+			Fee1      uint64 `json:"fee1"`
+			NextClaim string `json:"next_claim"`
+			Claimable bool   `json:"claimable"`
+		} `json:"pools"`
+		Totals         map[string]uint64 `json:"totals"`
+		Treasury       string            `json:"treasury"`
+		ClaimIntervalS uint64            `json:"claim_interval_s"`
+	}
+	result = callAsForTest(&ct, contractId, "claim_view_tx", "hive:bob", "hive:bob", "get_unclaimed_fees", `{}`)
+	assert.True(t, result.Success)
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &unclaimed))
+	assert.Len(t, unclaimed.Pools, 1)
+	assert.Equal(t, uint64(80), unclaimed.Pools[0].Fee0)
+	assert.Equal(t, "2025-01-02T00:00:01Z", unclaimed.Pools[0].NextClaim)
+	assert.False(t, unclaimed.Pools[0].Claimable)
+	assert.Equal(t, map[string]uint64{"HBD": 80, "HIVE": 0}, unclaimed.Totals)
+	assert.Equal(t, "system:fr_balance", unclaimed.Treasury)
+	assert.Equal(t, uint64(86400), unclaimed.ClaimIntervalS)
+
+	// Admins set the interval; only the owner moves the treasury
+	result = callAsForTest(&ct, contractId, "claim_interval_bob_tx", "hive:bob", "hive:bob", "set_fee_claim_interval", `{"interval_s": 60}`)
+	assertError(t, result, "E_UNAUTHORIZED", "admin only")
+	result = callAsForTest(&ct, contractId, "claim_interval_tx", "hive:alice", "hive:alice", "set_fee_claim_interval", `{"interval_s": 60}`)
+	assert.True(t, result.Success)
+	result = callAsForTest(&ct, contractId, "claim_treasury_bob_tx", "hive:bob", "hive:bob", "set_treasury", `"hive:bob"`)
+	assertError(t, result, "E_UNAUTHORIZED", "owner only")
+	result = callAsForTest(&ct, contractId, "claim_treasury_tx", "hive:alice", "hive:alice", "set_treasury", `"hive:dao"`)
+	assert.True(t, result.Success)
+
+	var envelope struct {
+		Events []struct {
+			Type   string `json:"type"`
+			PoolId string `json:"pool_id"`
+			Asset0 string `json:"asset0"`
+			Fee0   uint64 `json:"fee0"`
+			Fee1   uint64 `json:"fee1"`
+			To     string `json:"to"`
+		} `json:"events"`
+	}
+	result = callAsForTest(&ct, contractId, "claim_tx", "system:consensus", "system:consensus", "claim_fees", `"1"`)
+	assert.True(t, result.Success)
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &envelope))
+	assert.Len(t, envelope.Events, 1)
+	assert.Equal(t, "fees_claimed", envelope.Events[0].Type)
+	assert.Equal(t, "HBD", envelope.Events[0].Asset0)
+	assert.Equal(t, uint64(80), envelope.Events[0].Fee0)
+	assert.Equal(t, uint64(0), envelope.Events[0].Fee1)
+	assert.Equal(t, "hive:dao", envelope.Events[0].To)
+	assert.Equal(t, `"0"`, ct.StateGet(contractId, "pool/1/fee0"))
+	assert.Equal(t, `"2025-01-01T00:05:00Z"`, ct.StateGet(contractId, "pool/1/fee_last_claim"))
+
+	// The interval restarts from the claim
+	result = callAsForTest(&ct, contractId, "claim_again_tx", "system:consensus", "system:consensus", "claim_fees", `"1"`)
+	assertError(t, result, "E_CLAIM_INTERVAL", "fees already claimed, next claim at 2025-01-01T00:06:00Z")
+}
+
+func TestSlippageSurcharge(t *testing.T) {
+	ct := test_utils.NewContractTest()
+	contractId := "dex_router"
+	ct.RegisterContract(contractId, "hive:alice", contractWasm(t))
+
+	setupDexTest(&ct, contractId)
+	depositForTest(&ct, contractId, "slip_seed_tx", "hive:alice", "HBD", "HIVE", 1000000, 1000000)
+
+	result := callAsForTest(&ct, contractId, "slip_bob_tx", "hive:bob", "hive:bob", "set_slip_params", `{"pool_id": "1", "baseline_bps": 100, "share_bps": 5000}`)
+	assertError(t, result, "E_UNAUTHORIZED", "admin only")
+	result = callAsForTest(&ct, contractId, "slip_range_tx", "hive:alice", "hive:alice", "set_slip_params", `{"pool_id": "1", "baseline_bps": 100, "share_bps": 20000}`)
+	assertError(t, result, "E_INVALID_PARAM", "share_bps must be between 0 and 10000")
+	result = callAsForTest(&ct, contractId, "slip_params_tx", "hive:alice", "hive:alice", "set_slip_params", `{"pool_id": "1", "baseline_bps": 100, "share_bps": 5000}`)
+	assert.True(t, result.Success)
+
+	// 99920 * 1000000 / 1099920 = 90842 HIVE, 908 bps below the 99920 spot
+	// output; the 808 bps excess costs 7340 HIVE, half of it to the protocol
+	var quote struct {
+		AmountOut uint64 `json:"amount_out"`
+		Hops      []struct {
+			Fee             uint64 `json:"fee"`
+			SlipFee         uint64 `json:"slip_fee"`
+			SlipProtocolFee uint64 `json:"slip_protocol_fee"`
+		} `json:"hops"`
+	}
+	result = callAsForTest(&ct, contractId, "slip_quote_tx", "hive:bob", "hive:bob", "get_quote", `{
+		"type": "swap",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "hive:bob",
+		"amount_in": 100000
+	}`)
+	assert.True(t, result.Success)
+	assert.NoError(t, json.Unmarshal([]byte(result.Ret), &quote))
+	assert.Equal(t, uint64(83502), quote.AmountOut)
+	assert.Len(t, quote.Hops, 1)
+	assert.Equal(t, uint64(80), quote.Hops[0].Fee)
+	assert.Equal(t, uint64(7340), quote.Hops[0].SlipFee)
+	assert.Equal(t, uint64(3670), quote.Hops[0].SlipProtocolFee)
+
+	result = swapForTest(&ct, contractId, "slip_swap_tx", "hive:bob", "HBD", "HIVE", 100000)
+	assert.True(t, result.Success)
+	assert.Equal(t, `"80"`, ct.StateGet(contractId, "pool/1/fee0"))
+	assert.Equal(t, `"3670"`, ct.StateGet(contractId, "pool/1/fee1"))
+	// The LP half of the surcharge stays in the pool: 1000000 - 90842 + 3670
+	assert.Equal(t, `"1099920"`, ct.StateGet(contractId, "pool/1/reserve0"))
+	assert.Equal(t, `"912828"`, ct.StateGet(contractId, "pool/1/reserve1"))
+}
+
+func setupDexTest(ct *test_utils.ContractTest, contractId string) {
+	// Initialize contract
+	ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "init_tx",
+			BlockId:              "block:init",
+			Index:                0,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:00:00Z",
+			RequiredAuths:        []string{"hive:alice"},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "init",
+		Payload:    json.RawMessage([]byte(`"1.0.0"`)),
+		RcLimit:    10000,
+		Intents:    []contracts.Intent{},
+		Caller:     "hive:alice",
+	})
+
+	// HBD and HIVE are registered at init; register BTC for cross-chain pools
+	callAsForTest(ct, contractId, "register_btc_tx", "hive:alice", "hive:alice", "register_asset",
+		`{"symbol": "BTC", "decimals": 8}`)
+
+	// Create HIVE-HBD pool
+	ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "create_pool_tx",
+			BlockId:              "block:create_pool",
+			Index:                1,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:00:01Z",
+			RequiredAuths:        []string{"hive:alice"},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "create_pool",
+		Payload: json.RawMessage([]byte(`{
+			"asset0": "HBD",
+			"asset1": "HIVE",
+			"fee_bps": 8
+		}`)),
+		RcLimit:    10000,
+		Intents:    []contracts.Intent{},
+		Caller:     "hive:alice",
+	})
+}
+
+func addLiquidityToPool(ct *test_utils.ContractTest, contractId, poolId string, amt0, amt1 uint64) {
+	intents := []contracts.Intent{
+		allowIntent("HBD", int64(amt0)),
+		allowIntent("HIVE", int64(amt1)),
+	}
+
+	ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "add_liq_tx_" + poolId,
+			BlockId:              "block:add_liq_" + poolId,
+			Index:                100,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:01:00Z",
+			RequiredAuths:        []string{"hive:alice"},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "execute",
+		Payload: json.RawMessage(fmt.Sprintf(`{
+			"type": "deposit",
+			"version": "1.0.0",
+			"asset_in": "HBD",
+			"asset_out": "HIVE",
+			"recipient": "hive:alice",
+			"metadata": {
+				"amount0": %d,
+				"amount1": %d
+			}
+		}`, amt0, amt1)),
+		RcLimit: 10000,
+		Intents: intents,
+		Caller:  "hive:alice",
+	})
+}
+
+func createPoolForPair(ct *test_utils.ContractTest, contractId, asset0, asset1 string) {
+	ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "create_pool_tx_" + asset0 + "_" + asset1,
+			BlockId:              "block:create_pool_" + asset0 + "_" + asset1,
+			Index:                1,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:00:01Z",
+			RequiredAuths:        []string{"hive:alice"},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "create_pool",
+		Payload:    json.RawMessage(fmt.Sprintf(`{"asset0": "%s", "asset1": "%s", "fee_bps": 8}`, asset0, asset1)),
+		RcLimit:    10000,
+		Intents:    []contracts.Intent{},
+		Caller:     "hive:alice",
+	})
+}
+
+func addLiquidityForPair(ct *test_utils.ContractTest, contractId, asset0, asset1 string, amt0, amt1 uint64) {
+	intents := []contracts.Intent{
+		allowIntent(asset0, int64(amt0)),
+		allowIntent(asset1, int64(amt1)),
+	}
+
+	ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 "add_liq_tx_" + asset0 + "_" + asset1,
+			BlockId:              "block:add_liq_" + asset0 + "_" + asset1,
+			Index:                100,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:01:00Z",
+			RequiredAuths:        []string{"hive:alice"},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "execute",
+		Payload: json.RawMessage(fmt.Sprintf(`{
+			"type": "deposit",
+			"version": "1.0.0",
+			"asset_in": "%s",
+			"asset_out": "%s",
+			"recipient": "hive:alice",
+			"metadata": {
+				"amount0": %d,
+				"amount1": %d
+			}
+		}`, asset0, asset1, amt0, amt1)),
+		RcLimit: 10000,
+		Intents: intents,
+		Caller:  "hive:alice",
+	})
+}
+
+func depositForTest(ct *test_utils.ContractTest, contractId, txId, provider, asset0, asset1 string, amt0, amt1 uint64) stateEngine.TxResult {
+	intents := []contracts.Intent{
+		allowIntent(asset0, int64(amt0)),
+		allowIntent(asset1, int64(amt1)),
+	}
+
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 txId,
+			BlockId:              "block:" + txId,
+			Index:                10,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:03:00Z",
+			RequiredAuths:        []string{provider},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "execute",
+		Payload: json.RawMessage(fmt.Sprintf(`{
+			"type": "deposit",
+			"version": "1.0.0",
+			"asset_in": "%s",
+			"asset_out": "%s",
+			"recipient": "%s",
+			"metadata": {"amount0": %d, "amount1": %d}
+		}`, asset0, asset1, provider, amt0, amt1)),
+		RcLimit: 10000,
+		Intents: intents,
+		Caller:  provider,
+	})
+	return result
+}
+
+func withdrawForTest(ct *test_utils.ContractTest, contractId, txId, provider, asset0, asset1 string, lpAmount uint64) stateEngine.TxResult {
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 txId,
+			BlockId:              "block:" + txId,
+			Index:                11,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:04:00Z",
+			RequiredAuths:        []string{provider},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "execute",
+		Payload: json.RawMessage(fmt.Sprintf(`{
+			"type": "withdrawal",
+			"version": "1.0.0",
+			"asset_in": "%s",
+			"asset_out": "%s",
+			"recipient": "%s",
+			"metadata": {"lp_amount": %d}
+		}`, asset0, asset1, provider, lpAmount)),
+		RcLimit: 10000,
+		Intents: []contracts.Intent{},
+		Caller:  provider,
+	})
+	return result
+}
+
+func callAsForTest(ct *test_utils.ContractTest, contractId, txId, sender, caller, action, payload string) stateEngine.TxResult {
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 txId,
+			BlockId:              "block:" + txId,
+			Index:                12,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:05:00Z",
+			RequiredAuths:        []string{sender},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     action,
+		Payload:    json.RawMessage([]byte(payload)),
+		RcLimit:    10000,
+		Intents:    []contracts.Intent{},
+		Caller:     caller,
+	})
+	return result
+}
+
+func swapForTest(ct *test_utils.ContractTest, contractId, txId, sender, assetIn, assetOut string, amountIn uint64) stateEngine.TxResult {
+	intents := []contracts.Intent{
+		allowIntent(assetIn, int64(amountIn)),
+	}
+
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 txId,
+			BlockId:              "block:" + txId,
+			Index:                13,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:06:00Z",
+			RequiredAuths:        []string{sender},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "execute",
+		Payload: json.RawMessage(fmt.Sprintf(`{
+			"type": "swap",
+			"version": "1.0.0",
+			"asset_in": "%s",
+			"asset_out": "%s",
+			"recipient": "%s",
+			"amount_in": %d
+		}`, assetIn, assetOut, sender, amountIn)),
+		RcLimit: 10000,
+		Intents: intents,
+		Caller:  sender,
+	})
+	return result
+}
+
+// allowIntent returns a transfer.allow intent for amount base units of asset
+func allowIntent(asset string, amount int64) contracts.Intent {
+	return contracts.Intent{
+		Type: "transfer.allow",
+		Args: map[string]string{
+			"token": asset,
+			"limit": fmt.Sprintf("%d.%03d", amount/1000, amount%1000),
+		},
+	}
+}
+
+// assertError checks that result is the contract's error result for code and
+// message
+func assertError(t *testing.T, result stateEngine.TxResult, code, message string) {
+	t.Helper()
+	assert.JSONEq(t, fmt.Sprintf(`{"error": %q, "message": %q}`, code, message), result.Ret)
+}
+
+func executeForTest(ct *test_utils.ContractTest, contractId, txId, sender, payload string, amounts map[string]int64) stateEngine.TxResult {
+	intents := []contracts.Intent{}
+	for asset, amount := range amounts {
+		intents = append(intents, allowIntent(asset, amount))
+	}
+
+	result, _, _ := ct.Call(stateEngine.TxVscCallContract{
+		Self: stateEngine.TxSelf{
+			TxId:                 txId,
+			BlockId:              "block:" + txId,
+			Index:                14,
+			OpIndex:              0,
+			Timestamp:            "2025-01-01T00:07:00Z",
+			RequiredAuths:        []string{sender},
+			RequiredPostingAuths: []string{},
+		},
+		ContractId: contractId,
+		Action:     "execute",
+		Payload:    json.RawMessage([]byte(payload)),
+		RcLimit:    10000,
+		Intents:    intents,
+		Caller:     sender,
 	})
+	return result
 }
@@ -88,6 +88,30 @@ func TestInstructionParsing(t *testing.T) {
 	}
 }
 
+func TestSwapAmountFields(t *testing.T) {
+	jsonStr := `{
+		"type": "swap",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "alice",
+		"amount_in": 100000,
+		"min_amount_out": 47500
+	}`
+
+	var instruction DexInstruction
+	if err := json.Unmarshal([]byte(jsonStr), &instruction); err != nil {
+		t.Fatalf("Unexpected error parsing JSON: %v", err)
+	}
+
+	if instruction.AmountIn == nil || *instruction.AmountIn != 100000 {
+		t.Errorf("AmountIn = %v, want 100000", instruction.AmountIn)
+	}
+	if instruction.MinAmountOut == nil || *instruction.MinAmountOut != 47500 {
+		t.Errorf("MinAmountOut = %v, want 47500", instruction.MinAmountOut)
+	}
+}
+
 func TestSlippageCalculation(t *testing.T) {
 	tests := []struct {
 		name              string
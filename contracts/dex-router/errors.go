@@ -0,0 +1,68 @@
+package main
+
+import "encoding/json"
+
+// Error catalogue
+//
+// Every failure carries a stable code so the router and SDK can map it to a
+// status or UI message without matching the English text, which may change.
+// Failures detected before any state is written are returned as the call
+// result:
+//
+//	{"error":"E_POOL_NOT_FOUND","message":"no pool found for HBD/BTC"}
+//
+// Failures that must undo the whole transaction revert instead, with the
+// code as the revert symbol: sdk.Revert(message, code).
+const (
+	errCodeInvalidPayload     = "E_INVALID_PAYLOAD"        // payload missing, malformed or lacking a required field
+	errCodeInvalidParam       = "E_INVALID_PARAM"          // a field is out of range or does not apply
+	errCodeUnauthorized       = "E_UNAUTHORIZED"           // the signer lacks the owner, admin or system role
+	errCodeAlreadyInitialized = "E_ALREADY_INITIALIZED"    // init ran before
+	errCodePoolNotFound       = "E_POOL_NOT_FOUND"         // no pool for the id, pair, tier or a hop of the path
+	errCodePoolExists         = "E_POOL_EXISTS"            // the pair already has a pool at the fee tier
+	errCodeFeeTierRequired    = "E_FEE_TIER_REQUIRED"      // the pair has several tiers and fee_bps picks one
+	errCodePoolPaused         = "E_POOL_PAUSED"            // the pool is paused
+	errCodeZeroReserves       = "E_ZERO_RESERVES"          // the pool holds no liquidity to trade or redeem
+	errCodeInsufficientLiq    = "E_INSUFFICIENT_LIQUIDITY" // the amounts are too small to mint LP or move the price
+	errCodeOverflow           = "E_OVERFLOW"               // a reserve or supply would exceed 64 bits
+	errCodeInvalidPath        = "E_INVALID_PATH"           // the swap path is malformed
+	errCodeMinOutput          = "E_MIN_OUTPUT"             // output below min_amount_out or min_lp_out
+	errCodeSlippage           = "E_SLIPPAGE"               // reverts: output beyond slippage_bps of the spot price
+	errCodeExpired            = "E_EXPIRED"                // reverts: the instruction's deadline has passed
+	errCodeUnknownAsset       = "E_UNKNOWN_ASSET"          // the asset is not in the registry
+	errCodeAssetDisabled      = "E_ASSET_DISABLED"         // the asset is registered but disabled
+	errCodeAssetExists        = "E_ASSET_EXISTS"           // the asset is already registered
+	errCodeInsufficientLp     = "E_INSUFFICIENT_LP"        // the LP balance is below the amount
+	errCodeAllowance          = "E_INSUFFICIENT_ALLOWANCE" // the LP allowance is below the amount
+	errCodeLockedLiquidity    = "E_LOCKED_LIQUIDITY"       // the minimum liquidity lock cannot move
+	errCodeIntentMissing      = "E_INTENT_MISSING"         // no transfer.allow intent for an asset to draw
+	errCodeIntentInvalid      = "E_INTENT_INVALID"         // the transfer.allow limit does not parse
+	errCodeIntentExceeded     = "E_INTENT_EXCEEDED"        // the draw is above the transfer.allow limit
+	errCodeReturnAddress      = "E_RETURN_ADDRESS"         // the return_address cannot receive the refund
+	errCodeRefundUnavailable  = "E_REFUND_UNAVAILABLE"     // no mapping contract to refund through
+	errCodePriceHistory       = "E_PRICE_HISTORY"          // too few oracle observations for the window
+	errCodeClaimInterval      = "E_CLAIM_INTERVAL"         // the pool's fees were claimed less than an interval ago
+	errCodeInternal           = "E_INTERNAL"               // a result could not be serialized
+)
+
+// contractError is the JSON result of a failed call
+type contractError struct {
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+// fail returns the call result for a failure with code
+func fail(code, message string) *string {
+	jsonBytes, _ := json.Marshal(contractError{Code: code, Message: message})
+	result := string(jsonBytes)
+	return &result
+}
+
+// decodeError reads a result produced by fail; ok is false for any other
+// result
+func decodeError(result *string) (e contractError, ok bool) {
+	if result == nil || json.Unmarshal([]byte(*result), &e) != nil {
+		return contractError{}, false
+	}
+	return e, e.Code != ""
+}
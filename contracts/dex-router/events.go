@@ -0,0 +1,80 @@
+package main
+
+import (
+	sdk "dex-router/sdk"
+	"encoding/json"
+)
+
+// Event log
+//
+// Every state change emits a versioned JSON event. Each event is written to
+// the node log through sdk.Log as it happens, and the events of a call are
+// also returned together as its result so indexers polling contract outputs
+// can rebuild pool state without reading raw keys:
+//
+//	{"v":1,"events":[{"v":1,"type":"swap_executed","pool_id":"1",...}]}
+
+const eventVersion = 1
+
+const (
+	eventPoolCreated          = "pool_created"
+	eventSwapExecuted         = "swap_executed"
+	eventLiquidityAdded       = "liquidity_added"
+	eventLiquidityRemoved     = "liquidity_removed"
+	eventLpMinted             = "lp_minted"
+	eventLpBurned             = "lp_burned"
+	eventLpTransferred        = "lp_transferred"
+	eventLpApproved           = "lp_approved"
+	eventFeesClaimed          = "fees_claimed"
+	eventPoolFeeUpdated       = "pool_fee_updated"
+	eventSlipParamsUpdated    = "slip_params_updated"
+	eventPoolPaused           = "pool_paused"
+	eventPoolUnpaused         = "pool_unpaused"
+	eventOwnershipTransferred = "ownership_transferred"
+	eventAdminUpdated         = "admin_updated"
+	eventAssetRegistered      = "asset_registered"
+	eventAssetUpdated         = "asset_updated"
+	eventSwapRefunded         = "swap_refunded"
+	eventMappingContractSet   = "mapping_contract_set"
+	eventTreasuryUpdated      = "treasury_updated"
+	eventClaimIntervalUpdated = "fee_claim_interval_updated"
+)
+
+// Events emitted during the current call
+var pendingEvents []map[string]interface{}
+
+// emitEvent logs an event and queues it for the call result
+func emitEvent(eventType string, fields map[string]interface{}) {
+	event := map[string]interface{}{
+		"v":    eventVersion,
+		"type": eventType,
+	}
+	for k, v := range fields {
+		event[k] = v
+	}
+
+	jsonBytes, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	sdk.Log(string(jsonBytes))
+	pendingEvents = append(pendingEvents, event)
+}
+
+// eventsResult returns the queued events as the call result and resets the
+// queue. It returns nil when the call emitted nothing.
+func eventsResult() *string {
+	if len(pendingEvents) == 0 {
+		return nil
+	}
+	jsonBytes, err := json.Marshal(map[string]interface{}{
+		"v":      eventVersion,
+		"events": pendingEvents,
+	})
+	pendingEvents = nil
+	if err != nil {
+		return nil
+	}
+	result := string(jsonBytes)
+	return &result
+}
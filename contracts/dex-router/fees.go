@@ -0,0 +1,221 @@
+package main
+
+import (
+	sdk "dex-router/sdk"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Protocol fees
+//
+// The protocol's share of each swap fee accrues per pool in fee0/fee1. The
+// system account claims a pool's fees with claim_fees, at most once per claim
+// interval counted from fee_last_claim (set when the pool is created), and
+// they are transferred on the VSC ledger to the treasury, whatever the asset:
+//
+//	treasury            -> address, default system:fr_balance
+//	fee_claim_interval  -> seconds, default 1 day
+//
+// The owner sets the treasury with set_treasury; the owner or an admin sets
+// the interval with set_fee_claim_interval.
+
+const (
+	defaultTreasury      = "system:fr_balance"
+	maxFeeClaimIntervalS = 365 * 86400
+)
+
+// getTreasury returns the address claimed fees are sent to
+func getTreasury() string {
+	if treasury := getStr(keyTreasury); treasury != "" {
+		return treasury
+	}
+	return defaultTreasury
+}
+
+// getFeeClaimInterval returns the minimum seconds between claims of a pool
+func getFeeClaimInterval() uint64 {
+	if getStr(keyFeeClaimInterval) == "" {
+		return defaultFeeClaimIntervalS
+	}
+	return getUint(keyFeeClaimInterval)
+}
+
+// nextFeeClaim returns when a pool's fees may next be claimed; ok is false
+// when the pool was never stamped and may be claimed at any time
+func nextFeeClaim(poolId string) (next time.Time, ok bool) {
+	last, ok := parseTimestamp(getStr(poolFeeLastClaimKey(poolId)))
+	if !ok {
+		return time.Time{}, false
+	}
+	return last.Add(time.Duration(getFeeClaimInterval()) * time.Second), true
+}
+
+// poolFeesInfo returns the public view of a pool's unclaimed fees at the
+// block time now
+func poolFeesInfo(poolId string, now string) map[string]interface{} {
+	info := map[string]interface{}{
+		"pool_id":        poolId,
+		"asset0":         getPoolAsset0(poolId),
+		"asset1":         getPoolAsset1(poolId),
+		"fee0":           getUint(poolFee0Key(poolId)),
+		"fee1":           getUint(poolFee1Key(poolId)),
+		"fee_last_claim": getStr(poolFeeLastClaimKey(poolId)),
+		"next_claim":     "",
+		"claimable":      true,
+	}
+	if next, ok := nextFeeClaim(poolId); ok {
+		info["next_claim"] = next.UTC().Format(time.RFC3339)
+		t, nowOk := parseTimestamp(now)
+		info["claimable"] = nowOk && !t.Before(next)
+	}
+	return info
+}
+
+// Claim fees (system only)
+// Payload: pool_id
+//
+//go:wasmexport claim_fees
+func ClaimFees(payload *string) *string {
+	if !isSystemSender() {
+		return fail(errCodeUnauthorized, "system only")
+	}
+
+	if payload == nil {
+		return fail(errCodeInvalidPayload, "pool_id required")
+	}
+
+	poolId := *payload
+	asset0 := getPoolAsset0(poolId)
+	asset1 := getPoolAsset1(poolId)
+	if asset0 == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+
+	env := sdk.GetEnv()
+	if next, ok := nextFeeClaim(poolId); ok {
+		now, nowOk := parseTimestamp(env.Timestamp)
+		if !nowOk {
+			return fail(errCodeInternal, "block timestamp unreadable")
+		}
+		if now.Before(next) {
+			return fail(errCodeClaimInterval, "fees already claimed, next claim at "+next.UTC().Format(time.RFC3339))
+		}
+	}
+
+	f0 := getUint(poolFee0Key(poolId))
+	f1 := getUint(poolFee1Key(poolId))
+	if f0 == 0 && f1 == 0 {
+		return fail(errCodeInvalidParam, "no fees to claim")
+	}
+
+	treasury := getTreasury()
+	setUint(poolFee0Key(poolId), 0)
+	setUint(poolFee1Key(poolId), 0)
+	setStr(poolFeeLastClaimKey(poolId), env.Timestamp)
+	if f0 > 0 {
+		transferAsset(treasury, int64(f0), asset0)
+	}
+	if f1 > 0 {
+		transferAsset(treasury, int64(f1), asset1)
+	}
+
+	emitEvent(eventFeesClaimed, map[string]interface{}{
+		"pool_id":      poolId,
+		"asset0":       asset0,
+		"asset1":       asset1,
+		"fee0":         f0,
+		"fee1":         f1,
+		"to":           treasury,
+		"block_height": env.BlockHeight,
+		"timestamp":    env.Timestamp,
+	})
+
+	return eventsResult()
+}
+
+// List the unclaimed protocol fees of pools in creation order, with the
+// treasury and claim interval they are subject to
+// Payload: optional JSON {"offset": 0, "limit": 50}
+//
+//go:wasmexport get_unclaimed_fees
+func GetUnclaimedFees(payload *string) *string {
+	offset, limit, errMsg := parsePage(payload)
+	if errMsg != nil {
+		return errMsg
+	}
+
+	now := sdk.GetEnv().Timestamp
+	total := poolCount()
+	pools := []map[string]interface{}{}
+	totals := map[string]uint64{}
+	for id := offset + 1; offset < total && id <= min64(total, offset+limit); id++ {
+		info := poolFeesInfo(strconv.FormatUint(id, 10), now)
+		totals[info["asset0"].(string)] += info["fee0"].(uint64)
+		totals[info["asset1"].(string)] += info["fee1"].(uint64)
+		pools = append(pools, info)
+	}
+
+	return jsonResult(map[string]interface{}{
+		"pools":            pools,
+		"totals":           totals,
+		"treasury":         getTreasury(),
+		"claim_interval_s": getFeeClaimInterval(),
+		"total":            total,
+		"offset":           offset,
+		"limit":            limit,
+	})
+}
+
+// Set the address claimed fees are sent to (owner only)
+// Payload: treasury address (e.g. "hive:dao")
+//
+//go:wasmexport set_treasury
+func SetTreasury(payload *string) *string {
+	if !isOwner() {
+		return fail(errCodeUnauthorized, "owner only")
+	}
+	if payload == nil || *payload == "" {
+		return fail(errCodeInvalidPayload, "treasury address required")
+	}
+
+	oldTreasury := getTreasury()
+	setStr(keyTreasury, *payload)
+
+	emitEvent(eventTreasuryUpdated, map[string]interface{}{
+		"treasury":     *payload,
+		"old_treasury": oldTreasury,
+	})
+
+	return eventsResult()
+}
+
+// Set the minimum time between fee claims of a pool (owner or admin)
+// Payload: JSON {"interval_s": 86400}
+//
+//go:wasmexport set_fee_claim_interval
+func SetFeeClaimInterval(payload *string) *string {
+	if !isAdmin() {
+		return fail(errCodeUnauthorized, "admin only")
+	}
+
+	var params struct {
+		IntervalS *uint64 `json:"interval_s"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if params.IntervalS == nil || *params.IntervalS > maxFeeClaimIntervalS {
+		return fail(errCodeInvalidParam, "interval_s must be between 0 and 31536000")
+	}
+
+	oldInterval := getFeeClaimInterval()
+	setUint(keyFeeClaimInterval, *params.IntervalS)
+
+	emitEvent(eventClaimIntervalUpdated, map[string]interface{}{
+		"interval_s":     *params.IntervalS,
+		"old_interval_s": oldInterval,
+	})
+
+	return eventsResult()
+}
@@ -3,8 +3,8 @@ package main
 import (
 	sdk "dex-router/sdk"
 	"encoding/json"
-	"math/bits"
 	"strconv"
+	"strings"
 )
 
 func main() {}
@@ -16,11 +16,15 @@ type DexInstruction struct {
 	AssetIn       string                 `json:"asset_in"`
 	AssetOut      string                 `json:"asset_out"`
 	Recipient     string                 `json:"recipient"`
+	AmountIn      *int64                 `json:"amount_in,omitempty"`
 	SlippageBps   *int                   `json:"slippage_bps,omitempty"`
 	MinAmountOut  *int64                 `json:"min_amount_out,omitempty"`
+	Path          []string               `json:"path,omitempty"`
+	FeeBps        *uint64                `json:"fee_bps,omitempty"`
 	Beneficiary   *string                `json:"beneficiary,omitempty"`
 	RefBps        *int                   `json:"ref_bps,omitempty"`
 	ReturnAddress *ReturnAddress         `json:"return_address,omitempty"`
+	Deadline      *Deadline              `json:"deadline,omitempty"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -29,11 +33,33 @@ type ReturnAddress struct {
 	Address string `json:"address"`
 }
 
-// Contract initialization
+// Deadline is the last block height and/or block timestamp at which an
+// instruction may still execute
+type Deadline struct {
+	BlockHeight *uint64 `json:"block_height,omitempty"`
+	Timestamp   *string `json:"timestamp,omitempty"`
+}
+
+// Contract initialization; the signer becomes the contract owner
 // Payload: version string (e.g. "1.0.0")
 //
 //go:wasmexport init
 func Init(payload *string) *string {
+	if isInitialized() {
+		return fail(errCodeAlreadyInitialized, "already initialized")
+	}
+
+	env := sdk.GetEnv()
+	owner := env.Sender.Address.String()
+	if len(env.Sender.RequiredAuths) > 0 {
+		owner = env.Sender.RequiredAuths[0].String()
+	}
+	setStr(keyOwner, owner)
+
+	for _, asset := range defaultAssets {
+		registerAsset(asset.Symbol, asset.Decimals, true)
+	}
+
 	if payload == nil || *payload == "" {
 		setStr(keyVersion, "1.0.0")
 	} else {
@@ -43,36 +69,127 @@ func Init(payload *string) *string {
 	return nil
 }
 
+// Bring a deployment initialized before the contract had an owner up to
+// date (deployment owner only): the deployment owner becomes the contract
+// owner and the default assets are registered. Pools and LP are untouched.
+// Payload: none
+//
+//go:wasmexport migrate
+func Migrate(payload *string) *string {
+	if !isInitialized() {
+		return fail(errCodeInvalidParam, "not initialized, run init")
+	}
+	if getStr(keyOwner) != "" {
+		return fail(errCodeAlreadyInitialized, "already migrated")
+	}
+	owner := deploymentOwner()
+	if owner == "" || !hasRequiredAuth(owner) {
+		return fail(errCodeUnauthorized, "deployment owner only")
+	}
+
+	setStr(keyOwner, owner)
+	emitEvent(eventOwnershipTransferred, map[string]interface{}{
+		"from": "",
+		"to":   owner,
+	})
+
+	for _, asset := range defaultAssets {
+		if isAssetRegistered(asset.Symbol) {
+			continue
+		}
+		registerAsset(asset.Symbol, asset.Decimals, true)
+		emitEvent(eventAssetRegistered, map[string]interface{}{
+			"symbol":   asset.Symbol,
+			"decimals": asset.Decimals,
+			"enabled":  true,
+		})
+	}
+
+	return eventsResult()
+}
+
 // Create a new liquidity pool
 // Payload: JSON with pool parameters
-// {"asset0": "HBD", "asset1": "HIVE", "fee_bps": 8}
+// {"asset0": "HBD", "asset1": "HIVE", "fee_bps": 8}; "type": "stableswap"
+// with an "amp" coefficient creates a StableSwap pool for pegged pairs
 //
 
 //go:wasmexport create_pool
 func CreatePool(payload *string) *string {
 	if payload == nil {
-		return &[]string{"error", "payload required"}[1]
+		return fail(errCodeInvalidPayload, "payload required")
 	}
 
 	var params struct {
-		Asset0 string `json:"asset0"`
-		Asset1 string `json:"asset1"`
-		FeeBps uint64 `json:"fee_bps"`
+		Asset0           string  `json:"asset0"`
+		Asset1           string  `json:"asset1"`
+		FeeBps           uint64  `json:"fee_bps"`
+		ProtocolShareBps *uint64 `json:"protocol_share_bps"`
+		Type             string  `json:"type"`
+		Amp              *uint64 `json:"amp"`
 	}
 
 	if err := json.Unmarshal([]byte(*payload), &params); err != nil {
-		return &[]string{"error", "invalid payload"}[1]
+		return fail(errCodeInvalidPayload, "invalid payload")
 	}
 
 	// Validate assets are different
 	if params.Asset0 == params.Asset1 {
-		return &[]string{"error", "assets must be different"}[1]
+		return fail(errCodeInvalidParam, "assets must be different")
+	}
+
+	// Both assets must be enabled in the registry
+	if errMsg := checkAsset(params.Asset0, false); errMsg != nil {
+		return errMsg
+	}
+	if errMsg := checkAsset(params.Asset1, false); errMsg != nil {
+		return errMsg
 	}
 
 	// Default fee if not specified
 	if params.FeeBps == 0 {
 		params.FeeBps = defaultBaseFeeBps
 	}
+	if params.FeeBps > bpsDenominator {
+		return fail(errCodeInvalidParam, "fee_bps must be between 0 and 10000")
+	}
+
+	// One pool per pair and fee tier
+	if getPairPool(params.Asset0, params.Asset1, params.FeeBps) != "" {
+		return fail(errCodePoolExists, "pool already exists for pair")
+	}
+
+	// Share of the swap fee accrued to the protocol; the rest stays with LPs
+	protocolShare := uint64(defaultProtocolShareBps)
+	if params.ProtocolShareBps != nil {
+		if *params.ProtocolShareBps > bpsDenominator {
+			return fail(errCodeInvalidParam, "protocol_share_bps must be between 0 and 10000")
+		}
+		protocolShare = *params.ProtocolShareBps
+	}
+
+	// Constant product unless a StableSwap curve is requested
+	poolType := params.Type
+	if poolType == "" {
+		poolType = poolTypeConstantProduct
+	}
+	amp := uint64(0)
+	switch poolType {
+	case poolTypeConstantProduct:
+		if params.Amp != nil {
+			return fail(errCodeInvalidParam, "amp only applies to stableswap pools")
+		}
+	case poolTypeStableSwap:
+		amp = defaultStableAmp
+		if params.Amp != nil {
+			if *params.Amp == 0 || *params.Amp > maxStableAmp {
+				return fail(errCodeInvalidParam, "amp must be between 1 and 1000000")
+			}
+			amp = *params.Amp
+		}
+	default:
+		return fail(errCodeInvalidParam, "unknown pool type")
+	}
 
 	// Generate pool ID
 	poolId := strconv.FormatUint(getUint(keyNextPoolId), 10)
@@ -84,12 +201,31 @@ func CreatePool(payload *string) *string {
 	setPoolReserve0(poolId, 0)
 	setPoolReserve1(poolId, 0)
 	setPoolFee(poolId, params.FeeBps)
+	setPoolType(poolId, poolType)
+	if poolType == poolTypeStableSwap {
+		setPoolAmp(poolId, amp)
+	}
+	setPoolProtocolShare(poolId, protocolShare)
 	setPoolTotalLp(poolId, 0)
 	setUint(poolFee0Key(poolId), 0)
 	setUint(poolFee1Key(poolId), 0)
 	setStr(poolFeeLastClaimKey(poolId), sdk.GetEnv().Timestamp)
+	setPairPool(params.Asset0, params.Asset1, params.FeeBps, poolId)
+
+	created := map[string]interface{}{
+		"pool_id":            poolId,
+		"asset0":             params.Asset0,
+		"asset1":             params.Asset1,
+		"fee_bps":            params.FeeBps,
+		"protocol_share_bps": protocolShare,
+		"pool_type":          poolType,
+	}
+	if poolType == poolTypeStableSwap {
+		created["amp"] = amp
+	}
+	emitEvent(eventPoolCreated, created)
 
-	return nil
+	return eventsResult()
 }
 
 // Execute DEX operation based on JSON schema
@@ -98,456 +234,988 @@ func CreatePool(payload *string) *string {
 //go:wasmexport execute
 func Execute(payload *string) *string {
 	if payload == nil {
-		return &[]string{"error", "payload required"}[1]
+		return fail(errCodeInvalidPayload, "payload required")
 	}
 
 	var instruction DexInstruction
 	if err := json.Unmarshal([]byte(*payload), &instruction); err != nil {
-		return &[]string{"error", "invalid json payload"}[1]
+		return fail(errCodeInvalidPayload, "invalid json payload")
 	}
 
 	// Validate required fields
 	if instruction.Type == "" || instruction.Version == "" ||
 		instruction.AssetIn == "" || instruction.AssetOut == "" ||
 		instruction.Recipient == "" {
-		return &[]string{"error", "missing required fields"}[1]
+		return fail(errCodeInvalidPayload, "missing required fields")
+	}
+
+	if instruction.SlippageBps != nil && (*instruction.SlippageBps < 0 || *instruction.SlippageBps > 10000) {
+		return fail(errCodeInvalidParam, "slippage_bps must be between 0 and 10000")
+	}
+
+	// A stale instruction reverts outright rather than filling at a later
+	// price; a swap with a return address is refunded instead
+	if instruction.Deadline != nil {
+		env := sdk.GetEnv()
+		expired, ok := deadlinePassed(*instruction.Deadline, env.BlockHeight, env.Timestamp)
+		if !ok {
+			return fail(errCodeInvalidParam, "invalid deadline")
+		}
+		if expired {
+			if instruction.Type == "swap" && instruction.ReturnAddress != nil {
+				return refundRejectedSwap(instruction, fail(errCodeExpired, "instruction deadline passed"))
+			}
+			sdk.Revert("instruction deadline passed", errCodeExpired)
+			return nil
+		}
 	}
 
+	// Withdrawals accept disabled assets so providers can always exit
+	if errMsg := checkInstructionAssets(instruction, instruction.Type == "withdrawal"); errMsg != nil {
+		if instruction.Type == "swap" {
+			return refundRejectedSwap(instruction, errMsg)
+		}
+		return errMsg
+	}
+
+	var errMsg *string
 	switch instruction.Type {
 	case "swap":
-		return executeSwap(instruction)
+		errMsg = executeSwap(instruction)
 	case "deposit":
-		return executeDeposit(instruction)
+		errMsg = executeDeposit(instruction)
 	case "withdrawal":
-		return executeWithdrawal(instruction)
+		errMsg = executeWithdrawal(instruction)
 	default:
-		return &[]string{"error", "unknown instruction type"}[1]
+		return fail(errCodeInvalidPayload, "unknown instruction type")
+	}
+	if errMsg != nil {
+		return errMsg
 	}
+
+	return eventsResult()
 }
 
-// Execute swap operation
-func executeSwap(instruction DexInstruction) *string {
-	// Find direct pool first
-	directPoolId := findPool(instruction.AssetIn, instruction.AssetOut)
-	if directPoolId != "" {
-		return executeDirectSwap(directPoolId, instruction)
+// deadlinePassed reports whether block height or timestamp now is past
+// either bound of d. ok is false when d sets neither bound or its timestamp
+// (or now, when a timestamp bound is set) does not parse.
+func deadlinePassed(d Deadline, height uint64, now string) (passed, ok bool) {
+	if d.BlockHeight == nil && d.Timestamp == nil {
+		return false, false
 	}
-
-	// Try two-hop swap via HBD
-	if instruction.AssetIn != "HBD" && instruction.AssetOut != "HBD" {
-		return executeTwoHopSwap(instruction)
+	if d.BlockHeight != nil && height > *d.BlockHeight {
+		passed = true
 	}
-
-	return &[]string{"error", "no suitable pool found"}[1]
+	if d.Timestamp != nil {
+		limit, limitOk := parseTimestamp(*d.Timestamp)
+		current, nowOk := parseTimestamp(now)
+		if !limitOk || !nowOk {
+			return false, false
+		}
+		if current.After(limit) {
+			passed = true
+		}
+	}
+	return passed, true
 }
 
-// Find pool by assets - iterates through all pools to find matching pair
-func findPool(assetA, assetB string) string {
-	nextPoolId := getUint(keyNextPoolId)
-	for i := uint64(1); i < nextPoolId; i++ {
-		poolId := strconv.FormatUint(i, 10)
-		asset0 := getPoolAsset0(poolId)
-		asset1 := getPoolAsset1(poolId)
-		if asset0 == "" {
-			continue // Pool doesn't exist
-		}
-		// Check both asset orders
-		if (asset0 == assetA && asset1 == assetB) || (asset0 == assetB && asset1 == assetA) {
-			return poolId
+// checkInstructionAssets checks asset_in, asset_out and any path against the
+// asset registry
+func checkInstructionAssets(instruction DexInstruction, allowDisabled bool) *string {
+	assets := append([]string{instruction.AssetIn, instruction.AssetOut}, instruction.Path...)
+	for _, asset := range assets {
+		if errMsg := checkAsset(asset, allowDisabled); errMsg != nil {
+			return errMsg
 		}
 	}
-	return ""
+	return nil
 }
 
-// Execute direct swap within a pool
-func executeDirectSwap(poolId string, instruction DexInstruction) *string {
-	asset0 := getPoolAsset0(poolId)
-	asset1 := getPoolAsset1(poolId)
+// Execute swap operation along a direct pool or an explicit asset path. A
+// swap that cannot be filled is refunded to its return_address, if any (see
+// refund.go).
+func executeSwap(instruction DexInstruction) *string {
+	if errMsg := checkReturnAddress(instruction.ReturnAddress, instruction.AssetIn); errMsg != nil {
+		return errMsg
+	}
 
-	if asset0 == "" {
-		return &[]string{"error", "pool not found"}[1]
+	_, hops, errMsg := quoteSwap(instruction)
+	if errMsg != nil {
+		return refundSwap(instruction, errMsg)
 	}
+	amountIn := uint64(*instruction.AmountIn)
+	last := hops[len(hops)-1]
+	amountOut := last.AmountOut
 
-	r0 := getPoolReserve0(poolId)
-	r1 := getPoolReserve1(poolId)
-	feeBps := getPoolFee(poolId)
+	// Enforce the caller's output floor before touching any state
+	if instruction.MinAmountOut != nil && amountOut < uint64(*instruction.MinAmountOut) {
+		return refundSwap(instruction, fail(errCodeMinOutput, "output below min_amount_out"))
+	}
 
-	if r0 == 0 || r1 == 0 {
-		return &[]string{"error", "pool has zero reserves"}[1]
+	// Single slippage check over the whole route against the pre-swap spot prices
+	if instruction.SlippageBps != nil && exceedsSlippage(last.SpotOut, amountOut, *instruction.SlippageBps) {
+		if instruction.ReturnAddress != nil {
+			return refundSwap(instruction, fail(errCodeSlippage, "slippage tolerance exceeded"))
+		}
+		sdk.Revert("slippage tolerance exceeded", errCodeSlippage)
+		return nil
 	}
 
-	// For now, use MinAmountOut as the input amount (this is a simplification)
-	var amountInU uint64
-	if instruction.MinAmountOut != nil {
-		amountInU = uint64(*instruction.MinAmountOut)
-	} else {
-		return &[]string{"error", "amount_in required for swap"}[1]
+	if errMsg := checkDraw(instruction.AssetIn, amountIn); errMsg != nil {
+		return errMsg
+	}
+
+	// Apply every hop; all checks have passed so the route executes atomically
+	applySwapHops(hops, instruction.Recipient)
+
+	// Draw input asset and transfer output asset
+	drawAsset(int64(amountIn), instruction.AssetIn)
+
+	// Handle referral fees
+	if refOut := referralAmount(instruction, amountOut); refOut > 0 {
+		amountOut -= refOut
+		transferAsset(*instruction.Beneficiary, int64(refOut), instruction.AssetOut)
 	}
 
-	var amountOut uint64
-	var inputAsset, outputAsset string
-	var feeReserveKey string
+	transferAsset(instruction.Recipient, int64(amountOut), instruction.AssetOut)
 
-	// Determine swap direction and calculate output
-	if asset0 == instruction.AssetIn && asset1 == instruction.AssetOut {
-		// asset0 -> asset1
-		inputAsset = asset0
-		outputAsset = asset1
-		feeReserveKey = poolFee0Key(poolId)
+	return nil
+}
 
-		// Calculate output: dy = r1 - (r0 * r1) / (r0 + dx)
-		dx := amountInU * (10000 - feeBps) / 10000 // Apply fee
-		if dx == 0 {
-			dx = 1
+// applySwapHops writes the reserves and accrued protocol fees of computed
+// hops. The caller moves the input and output assets.
+func applySwapHops(hops []swapHop, recipient string) {
+	for _, hop := range hops {
+		setPoolReserves(hop.PoolId, hop.Reserve0, hop.Reserve1)
+
+		// Accrue the protocol share of the fee in the input asset and of the
+		// slippage surcharge in the output asset; the LP shares already sit
+		// in the pool reserves
+		inFeeKey, outFeeKey := poolFee1Key(hop.PoolId), poolFee0Key(hop.PoolId)
+		if hop.InputIsAsset0 {
+			inFeeKey, outFeeKey = outFeeKey, inFeeKey
+		}
+		if hop.ProtocolFee > 0 {
+			setUint(inFeeKey, getUint(inFeeKey)+hop.ProtocolFee)
+		}
+		if hop.SlipProtocolFee > 0 {
+			setUint(outFeeKey, getUint(outFeeKey)+hop.SlipProtocolFee)
 		}
-		k := r0 * r1
-		newR0 := r0 + dx
-		amountOut = r1 - (k / newR0)
 
-		// Update reserves
-		setPoolReserve0(poolId, newR0)
-		setPoolReserve1(poolId, r1-amountOut)
+		emitEvent(eventSwapExecuted, map[string]interface{}{
+			"pool_id":           hop.PoolId,
+			"asset_in":          hop.AssetIn,
+			"asset_out":         hop.AssetOut,
+			"amount_in":         hop.AmountIn,
+			"amount_out":        hop.AmountOut,
+			"fee":               hop.Fee,
+			"protocol_fee":      hop.ProtocolFee,
+			"slip_fee":          hop.SlipFee,
+			"slip_protocol_fee": hop.SlipProtocolFee,
+			"reserve0":          hop.Reserve0,
+			"reserve1":          hop.Reserve1,
+			"recipient":         recipient,
+		})
+	}
+}
 
-	} else if asset1 == instruction.AssetIn && asset0 == instruction.AssetOut {
-		// asset1 -> asset0
-		inputAsset = asset1
-		outputAsset = asset0
-		feeReserveKey = poolFee1Key(poolId)
+// quoteSwap resolves the route of a swap instruction and computes its hops
+// without writing state. Without an explicit path the pair must have a
+// direct pool. Each hop uses the instruction's fee tier when pinned, and
+// otherwise the pair's pool giving the most output.
+func quoteSwap(instruction DexInstruction) ([]string, []swapHop, *string) {
+	if instruction.AmountIn == nil || *instruction.AmountIn <= 0 {
+		return nil, nil, fail(errCodeInvalidPayload, "amount_in required for swap")
+	}
 
-		// Calculate output: dx = r0 - (r0 * r1) / (r1 + dy)
-		dy := amountInU // No fee for non-HBD input
-		k := r0 * r1
-		newR1 := r1 + dy
-		amountOut = r0 - (k / newR1)
+	path := instruction.Path
+	if len(path) == 0 {
+		if len(getPairTiers(instruction.AssetIn, instruction.AssetOut)) == 0 {
+			return nil, nil, fail(errCodePoolNotFound, "no direct pool found, path required")
+		}
+		path = []string{instruction.AssetIn, instruction.AssetOut}
+	}
+	if errMsg := validateSwapPath(path, instruction.AssetIn, instruction.AssetOut); errMsg != nil {
+		return nil, nil, errMsg
+	}
 
-		// Update reserves
-		setPoolReserve1(poolId, newR1)
-		setPoolReserve0(poolId, r0-amountOut)
+	hops, errMsg := quoteSwapPath(path, uint64(*instruction.AmountIn), instruction.FeeBps)
+	if errMsg != nil {
+		return nil, nil, errMsg
+	}
+	return path, hops, nil
+}
 
-	} else {
-		return &[]string{"error", "invalid asset pair for pool"}[1]
+// referralAmount returns the part of amountOut paid to the instruction's
+// beneficiary, always leaving at least one unit for the recipient
+func referralAmount(instruction DexInstruction, amountOut uint64) uint64 {
+	if instruction.Beneficiary == nil || instruction.RefBps == nil || amountOut == 0 {
+		return 0
 	}
+	refOut, _ := mulDiv(amountOut, uint64(*instruction.RefBps), bpsDenominator)
+	if refOut >= amountOut {
+		refOut = amountOut - 1
+	}
+	return refOut
+}
 
-	// Apply slippage protection if specified
-	if instruction.SlippageBps != nil {
-		minOut := amountOut * (10000 - uint64(*instruction.SlippageBps)) / 10000
-		if amountOut < minOut {
-			return &[]string{"error", "slippage tolerance exceeded"}[1]
+// findPool resolves a pair's pool through the pair index, in either asset
+// order. feeBps pins a fee tier; without it the pair must have one pool.
+func findPool(assetA, assetB string, feeBps *uint64) (string, *string) {
+	if feeBps != nil {
+		poolId := getPairPool(assetA, assetB, *feeBps)
+		if poolId == "" {
+			return "", fail(errCodePoolNotFound, "pool not found")
 		}
+		return poolId, nil
 	}
 
-	// Draw input asset and transfer output asset
-	drawAsset(int64(amountInU), inputAsset)
+	pools := getPairPools(assetA, assetB)
+	switch len(pools) {
+	case 0:
+		return "", fail(errCodePoolNotFound, "pool not found")
+	case 1:
+		return pools[0], nil
+	}
+	return "", fail(errCodeFeeTierRequired, "multiple fee tiers for pair, fee_bps required")
+}
 
-	// Handle referral fees
-	if instruction.Beneficiary != nil && instruction.RefBps != nil {
-		refOut := amountOut * uint64(*instruction.RefBps) / 10000
-		if refOut > 0 {
-			if refOut >= amountOut {
-				refOut = amountOut - 1
-			}
-			amountOut -= refOut
-			transferAsset(*instruction.Beneficiary, int64(refOut), outputAsset)
+// swapHop is one leg of a routed swap, computed without touching state
+type swapHop struct {
+	PoolId        string
+	AssetIn       string
+	AssetOut      string
+	InputIsAsset0 bool
+	AmountIn      uint64
+	AmountOut     uint64
+	Fee           uint64
+	// Part of Fee accrued to the protocol rather than left in the pool
+	ProtocolFee uint64
+	// Pool reserves after this hop
+	Reserve0 uint64
+	Reserve1 uint64
+	// Output expected at the spot prices seen by each hop so far
+	SpotOut uint64
+	// Slippage surcharge held back from AmountOut, and the part of it
+	// accrued to the protocol
+	SlipFee         uint64
+	SlipProtocolFee uint64
+}
+
+// validateSwapPath checks that an asset path runs from assetIn to assetOut
+// within the hop limit
+func validateSwapPath(path []string, assetIn, assetOut string) *string {
+	if len(path) < 2 || path[0] != assetIn || path[len(path)-1] != assetOut {
+		return fail(errCodeInvalidPath, "path must start with asset_in and end with asset_out")
+	}
+	if len(path)-1 > maxSwapHops {
+		return fail(errCodeInvalidPath, "path exceeds maximum hops")
+	}
+	for i := 1; i < len(path); i++ {
+		if path[i] == path[i-1] {
+			return fail(errCodeInvalidPath, "path contains a repeated asset")
 		}
 	}
+	return nil
+}
 
-	transferAsset(instruction.Recipient, int64(amountOut), outputAsset)
+// quoteSwapPath computes every hop of a swap along path without writing
+// state. A pool visited twice sees the reserves left by its earlier hop, so
+// applying the hops in order leaves each pool with its final reserves.
+// feeBps pins every hop to that fee tier; when nil each hop takes the pair's
+// pool with the best output.
+func quoteSwapPath(path []string, amountIn uint64, feeBps *uint64) ([]swapHop, *string) {
+	return quoteSwapPathAt(path, amountIn, feeBps, map[string][2]uint64{})
+}
 
-	// Accumulate fees (simplified - only for HBD input)
-	if inputAsset == "HBD" {
-		fee := amountInU - (amountInU * (10000 - feeBps) / 10000)
-		if fee > 0 {
-			currentFee := getUint(feeReserveKey)
-			setUint(feeReserveKey, currentFee+fee)
+// quoteSwapPathAt is quoteSwapPath with pending holding the reserves of pools
+// already changed earlier in the same call but not yet written
+func quoteSwapPathAt(path []string, amountIn uint64, feeBps *uint64, pending map[string][2]uint64) ([]swapHop, *string) {
+	hops := make([]swapHop, 0, len(path)-1)
+	amount := amountIn
+	spot := amountIn
+
+	for i := 0; i+1 < len(path); i++ {
+		pools := getPairPools(path[i], path[i+1])
+		if feeBps != nil {
+			pools = nil
+			if poolId := getPairPool(path[i], path[i+1], *feeBps); poolId != "" {
+				pools = []string{poolId}
+			}
+		}
+		if len(pools) == 0 {
+			return nil, fail(errCodePoolNotFound, "no pool found for "+path[i]+"/"+path[i+1])
+		}
+
+		// Pick the tier with the most output; later hops only gain from a
+		// larger input, so the best hop at each step gives the best route
+		var best swapHop
+		var errMsg *string
+		found := false
+		for _, poolId := range pools {
+			hop, hopErr := quoteHop(poolId, path[i], path[i+1], amount, spot, pending)
+			if hopErr != nil {
+				errMsg = hopErr
+				continue
+			}
+			if !found || hop.AmountOut > best.AmountOut {
+				best, found = hop, true
+			}
+		}
+		if !found {
+			return nil, errMsg
 		}
+
+		pending[best.PoolId] = [2]uint64{best.Reserve0, best.Reserve1}
+		hops = append(hops, best)
+		amount = best.AmountOut
+		spot = best.SpotOut
 	}
 
-	return nil
+	return hops, nil
 }
 
-// Execute two-hop swap via HBD
-func executeTwoHopSwap(instruction DexInstruction) *string {
-	// Find first pool: AssetIn -> HBD
-	pool1Id := findPool(instruction.AssetIn, "HBD")
-	if pool1Id == "" {
-		return &[]string{"error", "no pool found for first hop"}[1]
+// quoteHop computes a swap of amount through one pool, using the reserves
+// in pending when the pool already changed earlier in the call. spot is the
+// route's spot-price output so far.
+func quoteHop(poolId, assetIn, assetOut string, amount, spot uint64, pending map[string][2]uint64) (swapHop, *string) {
+	if isPoolPaused(poolId) {
+		return swapHop{}, fail(errCodePoolPaused, "pool paused")
 	}
 
-	// Find second pool: HBD -> AssetOut
-	pool2Id := findPool("HBD", instruction.AssetOut)
-	if pool2Id == "" {
-		return &[]string{"error", "no pool found for second hop"}[1]
+	reserves, seen := pending[poolId]
+	if !seen {
+		reserves = [2]uint64{getPoolReserve0(poolId), getPoolReserve1(poolId)}
+	}
+	if reserves[0] == 0 || reserves[1] == 0 {
+		return swapHop{}, fail(errCodeZeroReserves, "pool has zero reserves")
 	}
 
-	// Get pool information
-	asset1_0 := getPoolAsset0(pool1Id)
-	r1_0 := getPoolReserve0(pool1Id)
-	r1_1 := getPoolReserve1(pool1Id)
-	fee1 := getPoolFee(pool1Id)
+	hop := swapHop{
+		PoolId:        poolId,
+		AssetIn:       assetIn,
+		AssetOut:      assetOut,
+		InputIsAsset0: getPoolAsset0(poolId) == assetIn,
+		AmountIn:      amount,
+	}
+	curve := getPoolCurve(poolId, hop.InputIsAsset0)
+	in, out := 0, 1
+	if !hop.InputIsAsset0 {
+		in, out = 1, 0
+	}
 
-	r2_0 := getPoolReserve0(pool2Id)
-	r2_1 := getPoolReserve1(pool2Id)
-	fee2 := getPoolFee(pool2Id)
+	step, ok := curve.swap(amount, reserves[in], reserves[out])
+	if !ok {
+		return swapHop{}, fail(errCodeOverflow, "reserve overflow")
+	}
+	if step.AmountOut == 0 {
+		return swapHop{}, fail(errCodeInsufficientLiq, "insufficient output amount")
+	}
 
-	// Determine input amount (simplified - using MinAmountOut as input for now)
-	// In a real implementation, this would be passed explicitly or calculated
-	var amountIn uint64
-	if instruction.MinAmountOut != nil {
-		amountIn = uint64(*instruction.MinAmountOut)
-	} else {
-		return &[]string{"error", "amount_in required for two-hop swap"}[1]
+	hop.AmountOut = step.AmountOut
+	hop.Fee = step.Fee
+	hop.ProtocolFee = step.ProtocolFee
+	hop.SlipFee, hop.SlipProtocolFee = step.SlipFee, step.SlipProtocolFee
+	hop.SpotOut = curve.spotAmountOut(applyFeeBps(spot, curve.FeeBps), reserves[in], reserves[out])
+
+	reserves[in], reserves[out] = step.ReserveIn, step.ReserveOut
+	hop.Reserve0, hop.Reserve1 = reserves[0], reserves[1]
+
+	return hop, nil
+}
+
+// Execute deposit (add liquidity)
+func executeDeposit(instruction DexInstruction) *string {
+	// Find the pool
+	poolId, errMsg := findPool(instruction.AssetIn, instruction.AssetOut, instruction.FeeBps)
+	if errMsg != nil {
+		return errMsg
+	}
+	if isPoolPaused(poolId) {
+		return fail(errCodePoolPaused, "pool paused")
 	}
 
-	// Calculate first hop: AssetIn -> HBD
-	var amountIntermediate uint64
-	if asset1_0 == instruction.AssetIn {
-		// AssetIn is asset0, HBD is asset1
-		k1 := r1_0 * r1_1
-		dxEff := amountIn * (10000 - fee1) / 10000
-		if dxEff == 0 {
-			dxEff = 1
-		}
-		newR0 := r1_0 + dxEff
-		amountIntermediate = r1_1 - (k1 / newR0)
+	// A deposit with amount_in supplies only asset_in
+	if instruction.AmountIn != nil {
+		return executeZapDeposit(instruction, poolId)
+	}
 
-		// Update first pool reserves
-		setPoolReserve0(pool1Id, newR0)
-		setPoolReserve1(pool1Id, r1_1-amountIntermediate)
-	} else {
-		// AssetIn is asset1, HBD is asset0
-		k1 := r1_0 * r1_1
-		dyEff := amountIn * (10000 - fee1) / 10000
-		if dyEff == 0 {
-			dyEff = 1
-		}
-		newR1 := r1_1 + dyEff
-		amountIntermediate = r1_0 - (k1 / newR1)
-
-		// Update first pool reserves
-		setPoolReserve1(pool1Id, newR1)
-		setPoolReserve0(pool1Id, r1_0-amountIntermediate)
-	}
-
-	// Calculate second hop: HBD -> AssetOut
-	var amountOut uint64
-	if getPoolAsset0(pool2Id) == "HBD" {
-		// HBD is asset0, AssetOut is asset1
-		k2 := r2_0 * r2_1
-		dxEff := amountIntermediate * (10000 - fee2) / 10000
-		if dxEff == 0 {
-			dxEff = 1
-		}
-		newR0 := r2_0 + dxEff
-		amountOut = r2_1 - (k2 / newR0)
-
-		// Update second pool reserves
-		setPoolReserve0(pool2Id, newR0)
-		setPoolReserve1(pool2Id, r2_1-amountOut)
-	} else {
-		// HBD is asset1, AssetOut is asset0
-		k2 := r2_0 * r2_1
-		dyEff := amountIntermediate * (10000 - fee2) / 10000
-		if dyEff == 0 {
-			dyEff = 1
-		}
-		newR1 := r2_1 + dyEff
-		amountOut = r2_0 - (k2 / newR1)
+	// Deposit bounds come from metadata: amount0/amount1 are the most the
+	// provider will deposit of each asset and min_lp_out the least LP accepted
+	if instruction.Metadata == nil {
+		return fail(errCodeInvalidPayload, "deposit amounts required in metadata")
+	}
 
-		// Update second pool reserves
-		setPoolReserve1(pool2Id, newR1)
-		setPoolReserve0(pool2Id, r2_0-amountOut)
+	max0, found, errMsg := metadataUint(instruction.Metadata, "amount0")
+	if errMsg != nil {
+		return errMsg
+	}
+	if !found {
+		return fail(errCodeInvalidPayload, "amount0 required in metadata")
+	}
+	max1, found, errMsg := metadataUint(instruction.Metadata, "amount1")
+	if errMsg != nil {
+		return errMsg
 	}
+	if !found {
+		return fail(errCodeInvalidPayload, "amount1 required in metadata")
+	}
+	minLP, _, errMsg := metadataUint(instruction.Metadata, "min_lp_out")
+	if errMsg != nil {
+		return errMsg
+	}
+
+	return executeAddLiquidity(poolId, max0, max1, minLP, instruction.Recipient)
+}
 
-	// Apply slippage protection
-	if instruction.SlippageBps != nil {
-		minOut := amountOut * (10000 - uint64(*instruction.SlippageBps)) / 10000
-		if amountOut < minOut {
-			return &[]string{"error", "slippage tolerance exceeded"}[1]
+// Execute single-sided deposit: swap the optimal part of amount_in through
+// the pool, then add the rest and the swap output as liquidity. Stable pools
+// take the whole amount as an imbalanced deposit instead.
+func executeZapDeposit(instruction DexInstruction, poolId string) *string {
+	if *instruction.AmountIn <= 0 {
+		return fail(errCodeInvalidParam, "amount_in must be positive")
+	}
+	amount := uint64(*instruction.AmountIn)
+
+	var minLP uint64
+	if instruction.Metadata != nil {
+		var errMsg *string
+		minLP, _, errMsg = metadataUint(instruction.Metadata, "min_lp_out")
+		if errMsg != nil {
+			return errMsg
 		}
 	}
 
-	// Execute the transfers
-	drawAsset(int64(amountIn), instruction.AssetIn)
-	transferAsset(instruction.Recipient, int64(amountOut), instruction.AssetOut)
+	inputIsAsset0 := getPoolAsset0(poolId) == instruction.AssetIn
+	reserveIn, reserveOut := getPoolReserve0(poolId), getPoolReserve1(poolId)
+	if !inputIsAsset0 {
+		reserveIn, reserveOut = reserveOut, reserveIn
+	}
+	if reserveIn == 0 || reserveOut == 0 {
+		return fail(errCodeZeroReserves, "pool has zero reserves")
+	}
 
-	// Accumulate fees (simplified - only for HBD in first hop)
-	if instruction.AssetIn == "HBD" {
-		fee := amountIn - (amountIn * (10000 - fee1) / 10000)
-		if fee > 0 {
-			if asset1_0 == "HBD" {
-				setUint(poolFee0Key(pool1Id), getUint(poolFee0Key(pool1Id))+fee)
-			} else {
-				setUint(poolFee1Key(pool1Id), getUint(poolFee1Key(pool1Id))+fee)
-			}
+	if getPoolType(poolId) == poolTypeStableSwap {
+		max0, max1 := amount, uint64(0)
+		if !inputIsAsset0 {
+			max0, max1 = max1, max0
 		}
+		return executeAddLiquidity(poolId, max0, max1, minLP, instruction.Recipient)
 	}
 
-	return nil
-}
-
-// Execute deposit (add liquidity)
-func executeDeposit(instruction DexInstruction) *string {
-	// Find the pool
-	poolId := findPool(instruction.AssetIn, instruction.AssetOut)
-	if poolId == "" {
-		return &[]string{"error", "pool not found"}[1]
+	swapAmount := zapSwapAmount(amount, reserveIn, reserveOut, getPoolCurve(poolId, inputIsAsset0))
+	if swapAmount == 0 || swapAmount == amount {
+		return fail(errCodeInsufficientLiq, "amount_in too small for single-sided deposit")
 	}
+	hop, errMsg := quoteHop(poolId, instruction.AssetIn, instruction.AssetOut, swapAmount, swapAmount, map[string][2]uint64{})
+	if errMsg != nil {
+		return errMsg
+	}
+	hops := []swapHop{hop}
 
-	// For now, require deposit amounts to be specified in metadata
-	// In a real implementation, this might come from transaction intents
-	if instruction.Metadata == nil {
-		return &[]string{"error", "deposit amounts required in metadata"}[1]
+	if instruction.SlippageBps != nil && exceedsSlippage(hop.SpotOut, hop.AmountOut, *instruction.SlippageBps) {
+		sdk.Revert("slippage tolerance exceeded", errCodeSlippage)
+		return nil
 	}
 
-	amt0Interface, ok := instruction.Metadata["amount0"]
-	if !ok {
-		return &[]string{"error", "amount0 required in metadata"}[1]
+	// Deposit the unswapped rest and the swap output at the post-swap ratio
+	max0, max1 := amount-swapAmount, hop.AmountOut
+	if !inputIsAsset0 {
+		max0, max1 = max1, max0
 	}
-	amt1Interface, ok := instruction.Metadata["amount1"]
-	if !ok {
-		return &[]string{"error", "amount1 required in metadata"}[1]
+	plan, errMsg := planDeposit(hop.Reserve0, hop.Reserve1, getPoolTotalLp(poolId), max0, max1, minLP)
+	if errMsg != nil {
+		return errMsg
 	}
 
-	amt0Float, ok := amt0Interface.(float64)
-	if !ok {
-		return &[]string{"error", "amount0 must be number"}[1]
+	usedIn, usedOut := plan.Amount0, plan.Amount1
+	if !inputIsAsset0 {
+		usedIn, usedOut = usedOut, usedIn
 	}
-	amt1Float, ok := amt1Interface.(float64)
-	if !ok {
-		return &[]string{"error", "amount1 must be number"}[1]
+	if errMsg := checkDraw(instruction.AssetIn, swapAmount+usedIn); errMsg != nil {
+		return errMsg
 	}
 
-	amt0U := uint64(amt0Float)
-	amt1U := uint64(amt1Float)
+	applySwapHops(hops, instruction.Recipient)
+	applyDeposit(poolId, plan, instruction.Recipient)
+
+	drawAsset(int64(swapAmount+usedIn), instruction.AssetIn)
+
+	// Return any swap output the ratio could not take
+	if refund := hop.AmountOut - usedOut; refund > 0 {
+		transferAsset(instruction.Recipient, int64(refund), instruction.AssetOut)
+	}
+
+	return nil
+}
 
-	return executeAddLiquidity(poolId, amt0U, amt1U, instruction.Recipient)
+// metadataUint reads a non-negative integer amount from instruction metadata.
+// found is false when the key is absent.
+func metadataUint(metadata map[string]interface{}, key string) (uint64, bool, *string) {
+	raw, found := metadata[key]
+	if !found {
+		return 0, false, nil
+	}
+	value, ok := raw.(float64)
+	if !ok || value < 0 || value >= 1<<64 || value != float64(uint64(value)) {
+		return 0, true, fail(errCodeInvalidPayload, key+" must be a non-negative integer")
+	}
+	return uint64(value), true, nil
 }
 
 // Execute withdrawal (remove liquidity)
 func executeWithdrawal(instruction DexInstruction) *string {
 	// Find the pool
-	poolId := findPool(instruction.AssetIn, instruction.AssetOut)
-	if poolId == "" {
-		return &[]string{"error", "pool not found"}[1]
+	poolId, errMsg := findPool(instruction.AssetIn, instruction.AssetOut, instruction.FeeBps)
+	if errMsg != nil {
+		return errMsg
 	}
 
 	// For now, require LP amount to be specified in metadata
 	if instruction.Metadata == nil {
-		return &[]string{"error", "lp_amount required in metadata"}[1]
+		return fail(errCodeInvalidPayload, "lp_amount required in metadata")
 	}
 
-	lpAmountInterface, ok := instruction.Metadata["lp_amount"]
-	if !ok {
-		return &[]string{"error", "lp_amount required in metadata"}[1]
+	lpAmountU, found, errMsg := metadataUint(instruction.Metadata, "lp_amount")
+	if !found {
+		return fail(errCodeInvalidPayload, "lp_amount required in metadata")
+	}
+	if errMsg != nil {
+		return fail(errCodeInvalidParam, "lp_amount must be a non-negative integer")
 	}
 
-	lpAmountFloat, ok := lpAmountInterface.(float64)
-	if !ok {
-		return &[]string{"error", "lp_amount must be number"}[1]
+	// The recipient's LP is burned, so only the recipient may withdraw it
+	if !actsFor(instruction.Recipient) {
+		return fail(errCodeUnauthorized, "only the LP holder can withdraw")
 	}
 
-	lpAmountU := uint64(lpAmountFloat)
+	// single_asset returns everything as asset_out, swapping the asset_in
+	// share back through the pool
+	if singleAsset, _ := instruction.Metadata["single_asset"].(bool); singleAsset {
+		return executeSingleAssetWithdrawal(instruction, poolId, lpAmountU)
+	}
 
 	return executeRemoveLiquidity(poolId, lpAmountU, instruction.Recipient)
 }
 
-// Execute add liquidity operation
-func executeAddLiquidity(poolId string, amt0U, amt1U uint64, provider string) *string {
-	asset0 := getPoolAsset0(poolId)
-	asset1 := getPoolAsset1(poolId)
+// Execute single-asset withdrawal: burn LP and swap the asset_in share of
+// the redeemed liquidity into asset_out at the post-withdrawal reserves.
+// The swap makes it a trade, so a paused pool rejects it upfront; plain
+// withdrawals stay open.
+func executeSingleAssetWithdrawal(instruction DexInstruction, poolId string, lpAmountU uint64) *string {
+	if isPoolPaused(poolId) {
+		return fail(errCodePoolPaused, "pool paused, single-asset withdrawals disabled; withdraw proportionally")
+	}
+
+	provider := instruction.Recipient
+	plan, errMsg := planWithdrawal(poolId, lpAmountU, provider)
+	if errMsg != nil {
+		return errMsg
+	}
+
+	amountOut, swapIn := plan.Amount0, plan.Amount1
+	if getPoolAsset0(poolId) != instruction.AssetOut {
+		amountOut, swapIn = swapIn, amountOut
+	}
+
+	var hops []swapHop
+	if swapIn > 0 {
+		pending := map[string][2]uint64{poolId: {plan.Reserve0, plan.Reserve1}}
+		hop, errMsg := quoteHop(poolId, instruction.AssetIn, instruction.AssetOut, swapIn, swapIn, pending)
+		if errMsg != nil {
+			return errMsg
+		}
+		hops = []swapHop{hop}
+		amountOut += hop.AmountOut
+	}
+
+	if instruction.MinAmountOut != nil && amountOut < uint64(*instruction.MinAmountOut) {
+		return fail(errCodeMinOutput, "output below min_amount_out")
+	}
+
+	applyWithdrawal(poolId, plan, provider)
+	applySwapHops(hops, provider)
+
+	transferAsset(provider, int64(amountOut), instruction.AssetOut)
+
+	return nil
+}
+
+// Execute add liquidity operation. Only the amounts matching the pool ratio,
+// up to max0 and max1, are drawn from the provider; stable pools take both
+// in full.
+func executeAddLiquidity(poolId string, max0, max1, minLP uint64, provider string) *string {
+	r0, r1, totalLP := getPoolReserve0(poolId), getPoolReserve1(poolId), getPoolTotalLp(poolId)
+	var plan depositPlan
+	var errMsg *string
+	if getPoolType(poolId) == poolTypeStableSwap {
+		plan, errMsg = planStableDeposit(r0, r1, totalLP, max0, max1, minLP, getPoolCurve(poolId, true))
+	} else {
+		plan, errMsg = planDeposit(r0, r1, totalLP, max0, max1, minLP)
+	}
+	if errMsg != nil {
+		return errMsg
+	}
 
-	// Pull funds from user intents into contract
-	if amt0U > 0 {
-		drawAsset(int64(amt0U), asset0)
+	asset0, asset1 := getPoolAsset0(poolId), getPoolAsset1(poolId)
+	if errMsg := checkDraw(asset0, plan.Amount0); errMsg != nil {
+		return errMsg
 	}
-	if amt1U > 0 {
-		drawAsset(int64(amt1U), asset1)
+	if errMsg := checkDraw(asset1, plan.Amount1); errMsg != nil {
+		return errMsg
 	}
 
-	// Update reserves and mint LP
-	r0 := getPoolReserve0(poolId)
-	r1 := getPoolReserve1(poolId)
-	totalLP := getPoolTotalLp(poolId)
+	applyDeposit(poolId, plan, provider)
+
+	// Pull the matching amounts from user intents into contract
+	if plan.Amount0 > 0 {
+		drawAsset(int64(plan.Amount0), asset0)
+	}
+	if plan.Amount1 > 0 {
+		drawAsset(int64(plan.Amount1), asset1)
+	}
+
+	return nil
+}
+
+// depositPlan is a liquidity deposit computed without touching state
+type depositPlan struct {
+	Amount0 uint64
+	Amount1 uint64
+	// LP minted to the provider, and locked on a pool's first deposit
+	Minted uint64
+	Locked uint64
+	// Pool state after the deposit
+	Reserve0 uint64
+	Reserve1 uint64
+	TotalLP  uint64
+}
+
+// planDeposit computes a deposit of up to max0/max1 into a pool holding
+// reserves r0/r1 and totalLP, minting at least minLP to the provider
+func planDeposit(r0, r1, totalLP, max0, max1, minLP uint64) (depositPlan, *string) {
+	plan := depositPlan{Amount0: max0, Amount1: max1}
+	if totalLP > 0 {
+		var ok bool
+		plan.Amount0, plan.Amount1, ok = optimalDeposit(max0, max1, r0, r1)
+		if !ok {
+			return plan, fail(errCodeOverflow, "reserve overflow")
+		}
+	}
 
 	var minted uint64
 	if totalLP == 0 {
 		// Geometric mean using 128-bit product for first liquidity
-		hi, lo := bits.Mul64(amt0U, amt1U)
-		minted = sqrt128(hi, lo)
+		minted = initialLiquidity(plan.Amount0, plan.Amount1)
 	} else {
 		// Proportional minting
-		m0 := amt0U * totalLP / r0
-		m1 := amt1U * totalLP / r1
+		m0, ok0 := proportionalLiquidity(plan.Amount0, r0, totalLP)
+		m1, ok1 := proportionalLiquidity(plan.Amount1, r1, totalLP)
+		if !ok0 || !ok1 {
+			return plan, fail(errCodeOverflow, "reserve overflow")
+		}
 		minted = min64(m0, m1)
 	}
-	assertCustom(minted > 0)
 
-	// Update state
-	setPoolReserve0(poolId, r0+amt0U)
-	setPoolReserve1(poolId, r1+amt1U)
-	setPoolTotalLp(poolId, totalLP+minted)
+	return finishDeposit(plan, r0, r1, totalLP, minted, minLP)
+}
+
+// planStableDeposit computes a deposit of amount0/amount1 into a stable pool
+// holding reserves r0/r1 and totalLP. Any ratio is accepted; the LP minted
+// follows the growth of the invariant, less an imbalance fee (see
+// stableLiquidity), and must be at least minLP.
+func planStableDeposit(r0, r1, totalLP, amount0, amount1, minLP uint64, curve poolCurve) (depositPlan, *string) {
+	plan := depositPlan{Amount0: amount0, Amount1: amount1}
+	new0, ok0 := addU64(r0, amount0)
+	new1, ok1 := addU64(r1, amount1)
+	if !ok0 || !ok1 {
+		return plan, fail(errCodeOverflow, "reserve overflow")
+	}
+	minted, ok := stableLiquidity(r0, r1, new0, new1, totalLP, curve)
+	if !ok {
+		return plan, fail(errCodeOverflow, "reserve overflow")
+	}
+
+	return finishDeposit(plan, r0, r1, totalLP, minted, minLP)
+}
+
+// finishDeposit completes a plan drawing plan.Amount0/Amount1 for minted LP.
+// On a pool's first deposit the permanently locked minimum comes out of
+// minted.
+func finishDeposit(plan depositPlan, r0, r1, totalLP, minted, minLP uint64) (depositPlan, *string) {
+	plan.Minted = minted
+	if totalLP == 0 {
+		if plan.Minted <= minimumLiquidity {
+			return plan, fail(errCodeInsufficientLiq, "insufficient initial liquidity")
+		}
+		plan.Locked = minimumLiquidity
+		plan.Minted -= plan.Locked
+	}
+	if plan.Minted == 0 {
+		return plan, fail(errCodeInsufficientLiq, "insufficient liquidity minted")
+	}
+	if plan.Minted < minLP {
+		return plan, fail(errCodeMinOutput, "lp output below min_lp_out")
+	}
+
+	var ok0, ok1, okLP bool
+	plan.Reserve0, ok0 = addU64(r0, plan.Amount0)
+	plan.Reserve1, ok1 = addU64(r1, plan.Amount1)
+	plan.TotalLP, okLP = addU64(totalLP, plan.Minted+plan.Locked)
+	if !ok0 || !ok1 || !okLP {
+		return plan, fail(errCodeOverflow, "reserve overflow")
+	}
+
+	return plan, nil
+}
+
+// applyDeposit writes a planned deposit to state. The caller draws the
+// deposited assets.
+func applyDeposit(poolId string, plan depositPlan, provider string) {
+	setPoolReserves(poolId, plan.Reserve0, plan.Reserve1)
+	setPoolTotalLp(poolId, plan.TotalLP)
 
 	// Mint LP tokens to provider
 	currentLP := getPoolLp(poolId, provider)
-	setPoolLp(poolId, provider, currentLP+minted)
+	setPoolLp(poolId, provider, currentLP+plan.Minted)
+	if plan.Locked > 0 {
+		setPoolLp(poolId, burnAddress, plan.Locked)
+	}
 
-	return nil
+	emitEvent(eventLiquidityAdded, map[string]interface{}{
+		"pool_id":  poolId,
+		"provider": provider,
+		"amount0":  plan.Amount0,
+		"amount1":  plan.Amount1,
+		"reserve0": plan.Reserve0,
+		"reserve1": plan.Reserve1,
+	})
+	if plan.Locked > 0 {
+		emitEvent(eventLpMinted, map[string]interface{}{
+			"pool_id":  poolId,
+			"to":       burnAddress,
+			"amount":   plan.Locked,
+			"total_lp": plan.TotalLP - plan.Minted,
+		})
+	}
+	emitEvent(eventLpMinted, map[string]interface{}{
+		"pool_id":  poolId,
+		"to":       provider,
+		"amount":   plan.Minted,
+		"total_lp": plan.TotalLP,
+	})
 }
 
 // Execute remove liquidity operation
 func executeRemoveLiquidity(poolId string, lpAmountU uint64, provider string) *string {
-	providerAddr := sdk.Address(provider)
-	userLP := getPoolLp(poolId, providerAddr.String())
+	plan, errMsg := planWithdrawal(poolId, lpAmountU, provider)
+	if errMsg != nil {
+		return errMsg
+	}
+
+	applyWithdrawal(poolId, plan, provider)
+
+	// Transfer assets out
+	if plan.Amount0 > 0 {
+		transferAsset(provider, int64(plan.Amount0), getPoolAsset0(poolId))
+	}
+	if plan.Amount1 > 0 {
+		transferAsset(provider, int64(plan.Amount1), getPoolAsset1(poolId))
+	}
+
+	return nil
+}
+
+// withdrawalPlan is a liquidity withdrawal computed without touching state
+type withdrawalPlan struct {
+	LpAmount uint64
+	Amount0  uint64
+	Amount1  uint64
+	// Pool state after the withdrawal
+	Reserve0 uint64
+	Reserve1 uint64
+	TotalLP  uint64
+}
+
+// planWithdrawal computes the assets redeemed by burning lpAmountU of the
+// provider's LP
+func planWithdrawal(poolId string, lpAmountU uint64, provider string) (withdrawalPlan, *string) {
+	if provider == burnAddress {
+		return withdrawalPlan{}, fail(errCodeLockedLiquidity, "locked liquidity cannot be withdrawn")
+	}
+	userLP := getPoolLp(poolId, sdk.Address(provider).String())
 	totalLP := getPoolTotalLp(poolId)
 
-	assertCustom(lpAmountU > 0 && lpAmountU <= userLP && totalLP > 0)
+	if lpAmountU == 0 {
+		return withdrawalPlan{}, fail(errCodeInvalidParam, "lp_amount must be positive")
+	}
+	if lpAmountU > userLP {
+		return withdrawalPlan{}, fail(errCodeInsufficientLp, "insufficient LP balance")
+	}
+	if totalLP == 0 {
+		return withdrawalPlan{}, fail(errCodeZeroReserves, "pool has no liquidity")
+	}
 
 	r0 := getPoolReserve0(poolId)
 	r1 := getPoolReserve1(poolId)
 
 	// Calculate proportional amounts
-	amt0 := int64(r0 * lpAmountU / totalLP)
-	amt1 := int64(r1 * lpAmountU / totalLP)
+	out0, _ := withdrawalAmount(lpAmountU, r0, totalLP)
+	out1, _ := withdrawalAmount(lpAmountU, r1, totalLP)
+
+	return withdrawalPlan{
+		LpAmount: lpAmountU,
+		Amount0:  out0,
+		Amount1:  out1,
+		Reserve0: r0 - out0,
+		Reserve1: r1 - out1,
+		TotalLP:  totalLP - lpAmountU,
+	}, nil
+}
 
-	// Update state first
-	setPoolLp(poolId, providerAddr.String(), userLP-lpAmountU)
-	setPoolTotalLp(poolId, totalLP-lpAmountU)
-	setPoolReserve0(poolId, r0-uint64(amt0))
-	setPoolReserve1(poolId, r1-uint64(amt1))
+// applyWithdrawal burns the provider's LP and writes the reduced reserves.
+// The caller transfers the redeemed assets.
+func applyWithdrawal(poolId string, plan withdrawalPlan, provider string) {
+	userLP := getPoolLp(poolId, provider)
+	setPoolLp(poolId, provider, userLP-plan.LpAmount)
+	setPoolTotalLp(poolId, plan.TotalLP)
+	setPoolReserves(poolId, plan.Reserve0, plan.Reserve1)
+
+	emitEvent(eventLiquidityRemoved, map[string]interface{}{
+		"pool_id":  poolId,
+		"provider": provider,
+		"amount0":  plan.Amount0,
+		"amount1":  plan.Amount1,
+		"reserve0": plan.Reserve0,
+		"reserve1": plan.Reserve1,
+	})
+	emitEvent(eventLpBurned, map[string]interface{}{
+		"pool_id":  poolId,
+		"from":     provider,
+		"amount":   plan.LpAmount,
+		"total_lp": plan.TotalLP,
+	})
+}
 
-	// Transfer assets out
-	asset0 := getPoolAsset0(poolId)
-	asset1 := getPoolAsset1(poolId)
-	if amt0 > 0 {
-		transferAsset(provider, amt0, asset0)
+// Transfer LP to another address
+// Payload: JSON {"pool_id": "1", "to": "hive:bob", "amount": 1000}
+//
+//go:wasmexport transfer_lp
+func TransferLp(payload *string) *string {
+	var params struct {
+		PoolId string `json:"pool_id"`
+		To     string `json:"to"`
+		Amount uint64 `json:"amount"`
 	}
-	if amt1 > 0 {
-		transferAsset(provider, amt1, asset1)
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
 	}
 
-	return nil
+	if errMsg := moveLp(params.PoolId, callerAddress(), params.To, params.Amount); errMsg != nil {
+		return errMsg
+	}
+	return eventsResult()
 }
 
-// Helper functions
+// Allow a spender, such as a staking or vault contract, to move up to amount
+// of the caller's LP; the allowance is replaced, not added to
+// Payload: JSON {"pool_id": "1", "spender": "contract:vault", "amount": 1000}
+//
+//go:wasmexport approve_lp
+func ApproveLp(payload *string) *string {
+	var params struct {
+		PoolId  string `json:"pool_id"`
+		Spender string `json:"spender"`
+		Amount  uint64 `json:"amount"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if getPoolAsset0(params.PoolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+	if params.Spender == "" {
+		return fail(errCodeInvalidPayload, "spender required")
+	}
+
+	owner := callerAddress()
+	setPoolAllowance(params.PoolId, owner, params.Spender, params.Amount)
+
+	emitEvent(eventLpApproved, map[string]interface{}{
+		"pool_id": params.PoolId,
+		"owner":   owner,
+		"spender": params.Spender,
+		"amount":  params.Amount,
+	})
+
+	return eventsResult()
+}
 
-func calculateSwapOutput(amountIn, reserveIn, reserveOut, feeBps uint64, isAsset0Input bool) uint64 {
-	feeMultiplier := uint64(10000 - feeBps)
-	amountInAfterFee := amountIn * feeMultiplier / 10000
-	if amountInAfterFee == 0 {
-		amountInAfterFee = 1
+// Move LP out of an owner's balance using the caller's allowance; an
+// allowance of max uint64 is never decremented
+// Payload: JSON {"pool_id": "1", "from": "hive:alice", "to": "contract:vault", "amount": 1000}
+//
+//go:wasmexport transfer_lp_from
+func TransferLpFrom(payload *string) *string {
+	var params struct {
+		PoolId string `json:"pool_id"`
+		From   string `json:"from"`
+		To     string `json:"to"`
+		Amount uint64 `json:"amount"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if params.From == "" {
+		return fail(errCodeInvalidPayload, "from required")
 	}
 
-	k := reserveIn * reserveOut
-	newReserveIn := reserveIn + amountInAfterFee
-	amountOut := reserveOut - (k / newReserveIn)
+	spender := callerAddress()
+	allowance := getPoolAllowance(params.PoolId, params.From, spender)
+	if allowance < params.Amount {
+		return fail(errCodeAllowance, "insufficient allowance")
+	}
 
-	return amountOut
+	if errMsg := moveLp(params.PoolId, params.From, params.To, params.Amount); errMsg != nil {
+		return errMsg
+	}
+	if allowance != ^uint64(0) {
+		setPoolAllowance(params.PoolId, params.From, spender, allowance-params.Amount)
+	}
+	return eventsResult()
 }
 
-func applySlippageFee(amountOut, amountIn, amountInAfterFee, reserveIn, reserveOut uint64, isAsset0Input bool) uint64 {
-	// Simplified slippage fee calculation
-	// In full implementation, would calculate based on price impact
-	return amountOut
+// moveLp transfers LP between two balances of a pool
+func moveLp(poolId, from, to string, amount uint64) *string {
+	if getPoolAsset0(poolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+	if to == "" {
+		return fail(errCodeInvalidPayload, "to required")
+	}
+	if amount == 0 {
+		return fail(errCodeInvalidParam, "amount must be positive")
+	}
+	if from == burnAddress {
+		return fail(errCodeLockedLiquidity, "locked liquidity cannot be transferred")
+	}
+
+	fromLP := getPoolLp(poolId, from)
+	if fromLP < amount {
+		return fail(errCodeInsufficientLp, "insufficient LP balance")
+	}
+	if from != to {
+		setPoolLp(poolId, from, fromLP-amount)
+		setPoolLp(poolId, to, getPoolLp(poolId, to)+amount)
+	}
+
+	emitEvent(eventLpTransferred, map[string]interface{}{
+		"pool_id": poolId,
+		"from":    from,
+		"to":      to,
+		"amount":  amount,
+	})
+	return nil
 }
 
 // Query pool information
@@ -556,63 +1224,546 @@ func applySlippageFee(amountOut, amountIn, amountInAfterFee, reserveIn, reserveO
 //go:wasmexport get_pool
 func GetPool(payload *string) *string {
 	if payload == nil {
-		return &[]string{"error", "pool_id required"}[1]
+		return fail(errCodeInvalidPayload, "pool_id required")
+	}
+
+	poolId := *payload
+	if getPoolAsset0(poolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+
+	return jsonResult(poolInfo(poolId))
+}
+
+// List pools in creation order
+// Payload: optional JSON {"offset": 0, "limit": 50}
+//
+//go:wasmexport list_pools
+func ListPools(payload *string) *string {
+	offset, limit, errMsg := parsePage(payload)
+	if errMsg != nil {
+		return errMsg
+	}
+
+	total := poolCount()
+	pools := []map[string]interface{}{}
+	for id := offset + 1; offset < total && id <= min64(total, offset+limit); id++ {
+		pools = append(pools, poolInfo(strconv.FormatUint(id, 10)))
+	}
+
+	return jsonResult(map[string]interface{}{
+		"pools":  pools,
+		"total":  total,
+		"offset": offset,
+		"limit":  limit,
+	})
+}
+
+// Query a registered asset
+// Payload: symbol (e.g. "HBD")
+//
+//go:wasmexport get_asset
+func GetAsset(payload *string) *string {
+	if payload == nil {
+		return fail(errCodeInvalidPayload, "symbol required")
+	}
+	if !isAssetRegistered(*payload) {
+		return fail(errCodeUnknownAsset, "unknown asset "+*payload)
+	}
+
+	return jsonResult(assetInfo(*payload))
+}
+
+// List registered assets in registration order
+// Payload: optional JSON {"offset": 0, "limit": 50}
+//
+//go:wasmexport list_assets
+func ListAssets(payload *string) *string {
+	offset, limit, errMsg := parsePage(payload)
+	if errMsg != nil {
+		return errMsg
+	}
+
+	total := getUint(keyAssetCount)
+	assets := []map[string]interface{}{}
+	for n := offset + 1; offset < total && n <= min64(total, offset+limit); n++ {
+		assets = append(assets, assetInfo(getStr(assetIndexKey(n))))
+	}
+
+	return jsonResult(map[string]interface{}{
+		"assets": assets,
+		"total":  total,
+		"offset": offset,
+		"limit":  limit,
+	})
+}
+
+// Query an address's LP balances
+// Payload: JSON {"address": "hive:alice", "pool_id": "1"}; without pool_id
+// the pools in the optional offset/limit page are scanned and the non-zero
+// balances returned
+//
+//go:wasmexport get_lp_balance
+func GetLpBalance(payload *string) *string {
+	if payload == nil {
+		return fail(errCodeInvalidPayload, "payload required")
+	}
+
+	var params struct {
+		Address string `json:"address"`
+		PoolId  string `json:"pool_id"`
+	}
+	if err := json.Unmarshal([]byte(*payload), &params); err != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if params.Address == "" {
+		return fail(errCodeInvalidPayload, "address required")
+	}
+
+	lpBalance := func(poolId string) map[string]interface{} {
+		return map[string]interface{}{
+			"pool_id":  poolId,
+			"lp":       getPoolLp(poolId, params.Address),
+			"total_lp": getPoolTotalLp(poolId),
+		}
+	}
+
+	if params.PoolId != "" {
+		if getPoolAsset0(params.PoolId) == "" {
+			return fail(errCodePoolNotFound, "pool not found")
+		}
+		return jsonResult(map[string]interface{}{
+			"address":  params.Address,
+			"balances": []map[string]interface{}{lpBalance(params.PoolId)},
+		})
+	}
+
+	offset, limit, errMsg := parsePage(payload)
+	if errMsg != nil {
+		return errMsg
+	}
+	total := poolCount()
+	balances := []map[string]interface{}{}
+	for id := offset + 1; offset < total && id <= min64(total, offset+limit); id++ {
+		poolId := strconv.FormatUint(id, 10)
+		if getPoolLp(poolId, params.Address) > 0 {
+			balances = append(balances, lpBalance(poolId))
+		}
+	}
+
+	return jsonResult(map[string]interface{}{
+		"address":  params.Address,
+		"balances": balances,
+		"total":    total,
+		"offset":   offset,
+		"limit":    limit,
+	})
+}
+
+// Query the LP a spender may still move for an owner
+// Payload: JSON {"pool_id": "1", "owner": "hive:alice", "spender": "contract:vault"}
+//
+//go:wasmexport get_lp_allowance
+func GetLpAllowance(payload *string) *string {
+	var params struct {
+		PoolId  string `json:"pool_id"`
+		Owner   string `json:"owner"`
+		Spender string `json:"spender"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if getPoolAsset0(params.PoolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+
+	return jsonResult(map[string]interface{}{
+		"pool_id":   params.PoolId,
+		"owner":     params.Owner,
+		"spender":   params.Spender,
+		"allowance": getPoolAllowance(params.PoolId, params.Owner, params.Spender),
+	})
+}
+
+// Query accrued protocol fees of a pool
+// Payload: pool_id
+//
+//go:wasmexport get_pool_fees
+func GetPoolFees(payload *string) *string {
+	if payload == nil {
+		return fail(errCodeInvalidPayload, "pool_id required")
 	}
 
 	poolId := *payload
-	asset0 := getPoolAsset0(poolId)
-	if asset0 == "" {
-		return &[]string{"error", "pool not found"}[1]
+	if getPoolAsset0(poolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+
+	return jsonResult(poolFeesInfo(poolId, sdk.GetEnv().Timestamp))
+}
+
+// poolInfo returns the public view of a pool
+func poolInfo(poolId string) map[string]interface{} {
+	info := map[string]interface{}{
+		"pool_id":            poolId,
+		"asset0":             getPoolAsset0(poolId),
+		"asset1":             getPoolAsset1(poolId),
+		"reserve0":           getPoolReserve0(poolId),
+		"reserve1":           getPoolReserve1(poolId),
+		"fee":                getPoolFee(poolId),
+		"total_lp":           getPoolTotalLp(poolId),
+		"protocol_share_bps": getPoolProtocolShare(poolId),
+		"paused":             isPoolPaused(poolId),
+		"type":               getPoolType(poolId),
+	}
+	info["slip_baseline_bps"], info["slip_share_bps"] = getPoolSlipParams(poolId)
+	if info["type"] == poolTypeStableSwap {
+		info["amp"] = getPoolAmp(poolId)
 	}
+	return info
+}
 
-	poolInfo := map[string]interface{}{
-		"asset0":   asset0,
-		"asset1":   getPoolAsset1(poolId),
-		"reserve0": getPoolReserve0(poolId),
-		"reserve1": getPoolReserve1(poolId),
-		"fee":      getPoolFee(poolId),
-		"total_lp": getPoolTotalLp(poolId),
+// parsePage reads the optional offset/limit of a paginated query
+func parsePage(payload *string) (uint64, uint64, *string) {
+	var page struct {
+		Offset uint64 `json:"offset"`
+		Limit  uint64 `json:"limit"`
+	}
+	if payload != nil && *payload != "" {
+		if err := json.Unmarshal([]byte(*payload), &page); err != nil {
+			return 0, 0, fail(errCodeInvalidPayload, "invalid payload")
+		}
+	}
+	if page.Limit == 0 {
+		page.Limit = defaultPageLimit
+	}
+	if page.Limit > maxPageLimit {
+		page.Limit = maxPageLimit
 	}
+	return page.Offset, page.Limit, nil
+}
 
-	jsonBytes, err := json.Marshal(poolInfo)
+// jsonResult serializes a query response
+func jsonResult(v interface{}) *string {
+	jsonBytes, err := json.Marshal(v)
 	if err != nil {
-		return &[]string{"error", "serialization failed"}[1]
+		return fail(errCodeInternal, "serialization failed")
 	}
 
 	result := string(jsonBytes)
 	return &result
 }
 
-// Claim fees (system only)
-// Payload: pool_id
+// Quote a swap without executing it
+// Payload: JSON instruction as for execute, type "swap"
+//
+//go:wasmexport get_quote
+func GetQuote(payload *string) *string {
+	if payload == nil {
+		return fail(errCodeInvalidPayload, "payload required")
+	}
+
+	var instruction DexInstruction
+	if err := json.Unmarshal([]byte(*payload), &instruction); err != nil {
+		return fail(errCodeInvalidPayload, "invalid json payload")
+	}
+	if instruction.Type != "swap" {
+		return fail(errCodeInvalidPayload, "quotes are only available for swaps")
+	}
+	if errMsg := checkInstructionAssets(instruction, false); errMsg != nil {
+		return errMsg
+	}
+
+	path, hops, errMsg := quoteSwap(instruction)
+	if errMsg != nil {
+		return errMsg
+	}
+	last := hops[len(hops)-1]
+
+	hopInfo := make([]map[string]interface{}, 0, len(hops))
+	for _, hop := range hops {
+		hopInfo = append(hopInfo, map[string]interface{}{
+			"pool_id":           hop.PoolId,
+			"fee_bps":           getPoolFee(hop.PoolId),
+			"asset_in":          hop.AssetIn,
+			"asset_out":         hop.AssetOut,
+			"amount_in":         hop.AmountIn,
+			"amount_out":        hop.AmountOut,
+			"fee":               hop.Fee,
+			"protocol_fee":      hop.ProtocolFee,
+			"slip_fee":          hop.SlipFee,
+			"slip_protocol_fee": hop.SlipProtocolFee,
+		})
+	}
+
+	refOut := referralAmount(instruction, last.AmountOut)
+	quote := map[string]interface{}{
+		"amount_in":        uint64(*instruction.AmountIn),
+		"amount_out":       last.AmountOut - refOut,
+		"referral_fee":     refOut,
+		"spot_amount_out":  last.SpotOut,
+		"price_impact_bps": priceImpactBps(last.SpotOut, last.AmountOut),
+		"path":             path,
+		"hops":             hopInfo,
+	}
+
+	return jsonResult(quote)
+}
+
+// Update a pool's swap fee (owner or admin)
+// Payload: JSON {"pool_id": "1", "fee_bps": 30}
+//
+//go:wasmexport set_pool_fee
+func SetPoolFee(payload *string) *string {
+	if !isAdmin() {
+		return fail(errCodeUnauthorized, "admin only")
+	}
+
+	var params struct {
+		PoolId string  `json:"pool_id"`
+		FeeBps *uint64 `json:"fee_bps"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if getPoolAsset0(params.PoolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+	if params.FeeBps == nil || *params.FeeBps > bpsDenominator {
+		return fail(errCodeInvalidParam, "fee_bps must be between 0 and 10000")
+	}
+
+	// The pair index is keyed by fee tier, so the pool moves to its new tier
+	oldFee := getPoolFee(params.PoolId)
+	asset0, asset1 := getPoolAsset0(params.PoolId), getPoolAsset1(params.PoolId)
+	if *params.FeeBps != oldFee {
+		if getPairPool(asset0, asset1, *params.FeeBps) != "" {
+			return fail(errCodePoolExists, "fee tier already exists for pair")
+		}
+		removePairPool(asset0, asset1, oldFee)
+		setPairPool(asset0, asset1, *params.FeeBps, params.PoolId)
+	}
+	setPoolFee(params.PoolId, *params.FeeBps)
+
+	emitEvent(eventPoolFeeUpdated, map[string]interface{}{
+		"pool_id":     params.PoolId,
+		"fee_bps":     *params.FeeBps,
+		"old_fee_bps": oldFee,
+	})
+
+	return eventsResult()
+}
+
+// Set a pool's slippage surcharge (owner or admin): swaps whose price impact
+// exceeds baseline_bps pay the excess as an extra fee out of their output,
+// share_bps of it to the protocol and the rest to LPs. A zero baseline turns
+// the surcharge off.
+// Payload: JSON {"pool_id": "1", "baseline_bps": 100, "share_bps": 5000}
 //
-//go:wasmexport claim_fees
-func ClaimFees(payload *string) *string {
-	if !isSystemSender() {
-		return &[]string{"error", "system only"}[1]
+//go:wasmexport set_slip_params
+func SetSlipParams(payload *string) *string {
+	if !isAdmin() {
+		return fail(errCodeUnauthorized, "admin only")
+	}
+
+	var params struct {
+		PoolId      string  `json:"pool_id"`
+		BaselineBps *uint64 `json:"baseline_bps"`
+		ShareBps    *uint64 `json:"share_bps"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if getPoolAsset0(params.PoolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
 	}
+	if params.BaselineBps == nil || *params.BaselineBps >= bpsDenominator {
+		return fail(errCodeInvalidParam, "baseline_bps must be between 0 and 9999")
+	}
+	if params.ShareBps == nil || *params.ShareBps > bpsDenominator {
+		return fail(errCodeInvalidParam, "share_bps must be between 0 and 10000")
+	}
+
+	setPoolSlipParams(params.PoolId, *params.BaselineBps, *params.ShareBps)
+
+	emitEvent(eventSlipParamsUpdated, map[string]interface{}{
+		"pool_id":      params.PoolId,
+		"baseline_bps": *params.BaselineBps,
+		"share_bps":    *params.ShareBps,
+	})
+
+	return eventsResult()
+}
+
+// Stop swaps and deposits on a pool (owner or admin); withdrawals stay open
+// so providers can always exit
+// Payload: pool_id
+//
+//go:wasmexport pause_pool
+func PausePool(payload *string) *string {
+	return setPaused(payload, true)
+}
 
+// Resume a paused pool (owner or admin)
+// Payload: pool_id
+//
+//go:wasmexport unpause_pool
+func UnpausePool(payload *string) *string {
+	return setPaused(payload, false)
+}
+
+func setPaused(payload *string, paused bool) *string {
+	if !isAdmin() {
+		return fail(errCodeUnauthorized, "admin only")
+	}
 	if payload == nil {
-		return &[]string{"error", "pool_id required"}[1]
+		return fail(errCodeInvalidPayload, "pool_id required")
 	}
 
 	poolId := *payload
-	asset0 := getPoolAsset0(poolId)
-	asset1 := getPoolAsset1(poolId)
-	dao := sdk.Address("system:fr_balance")
+	if getPoolAsset0(poolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+	if isPoolPaused(poolId) == paused {
+		return nil
+	}
 
-	f0 := getUint(poolFee0Key(poolId))
-	f1 := getUint(poolFee1Key(poolId))
+	setPoolPaused(poolId, paused)
+	eventType := eventPoolUnpaused
+	if paused {
+		eventType = eventPoolPaused
+	}
+	emitEvent(eventType, map[string]interface{}{
+		"pool_id": poolId,
+	})
+
+	return eventsResult()
+}
 
-	if f0 > 0 && isHbd(asset0) {
-		setUint(poolFee0Key(poolId), 0)
-		sdk.HiveWithdraw(dao, int64(f0), sdk.Asset(asset0))
+// Hand the contract to a new owner (owner only)
+// Payload: new owner address (e.g. "hive:bob")
+//
+//go:wasmexport transfer_ownership
+func TransferOwnership(payload *string) *string {
+	if !isOwner() {
+		return fail(errCodeUnauthorized, "owner only")
 	}
-	if f1 > 0 && isHbd(asset1) {
-		setUint(poolFee1Key(poolId), 0)
-		sdk.HiveWithdraw(dao, int64(f1), sdk.Asset(asset1))
+	if payload == nil || *payload == "" {
+		return fail(errCodeInvalidPayload, "new owner required")
 	}
 
-	setStr(poolFeeLastClaimKey(poolId), sdk.GetEnv().Timestamp)
-	return nil
+	oldOwner := getStr(keyOwner)
+	setStr(keyOwner, *payload)
+
+	emitEvent(eventOwnershipTransferred, map[string]interface{}{
+		"from": oldOwner,
+		"to":   *payload,
+	})
+
+	return eventsResult()
+}
+
+// Grant or revoke admin rights (owner only)
+// Payload: JSON {"address": "hive:bob", "enabled": true}
+//
+//go:wasmexport set_admin
+func SetAdmin(payload *string) *string {
+	if !isOwner() {
+		return fail(errCodeUnauthorized, "owner only")
+	}
+
+	var params struct {
+		Address string `json:"address"`
+		Enabled bool   `json:"enabled"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if params.Address == "" {
+		return fail(errCodeInvalidPayload, "address required")
+	}
+
+	if params.Enabled {
+		setStr(adminKey(params.Address), "true")
+	} else {
+		sdk.StateDeleteObject(adminKey(params.Address))
+	}
+
+	emitEvent(eventAdminUpdated, map[string]interface{}{
+		"address": params.Address,
+		"enabled": params.Enabled,
+	})
+
+	return eventsResult()
+}
+
+// Add an asset to the registry (owner or admin)
+// Payload: JSON {"symbol": "BTC", "decimals": 8, "enabled": true}; enabled
+// defaults to true
+//
+//go:wasmexport register_asset
+func RegisterAsset(payload *string) *string {
+	if !isAdmin() {
+		return fail(errCodeUnauthorized, "admin only")
+	}
+
+	var params struct {
+		Symbol   string `json:"symbol"`
+		Decimals uint64 `json:"decimals"`
+		Enabled  *bool  `json:"enabled"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if params.Symbol == "" || strings.Contains(params.Symbol, "/") {
+		return fail(errCodeInvalidParam, "invalid symbol")
+	}
+	if params.Decimals > maxAssetDecimals {
+		return fail(errCodeInvalidParam, "decimals must be between 0 and 18")
+	}
+	if isAssetRegistered(params.Symbol) {
+		return fail(errCodeAssetExists, "asset already registered")
+	}
+
+	enabled := params.Enabled == nil || *params.Enabled
+	registerAsset(params.Symbol, params.Decimals, enabled)
+
+	emitEvent(eventAssetRegistered, map[string]interface{}{
+		"symbol":   params.Symbol,
+		"decimals": params.Decimals,
+		"enabled":  enabled,
+	})
+
+	return eventsResult()
+}
+
+// Enable or disable a registered asset (owner or admin); pools holding a
+// disabled asset stop trading but still allow withdrawals
+// Payload: JSON {"symbol": "BTC", "enabled": false}
+//
+//go:wasmexport set_asset_enabled
+func SetAssetEnabled(payload *string) *string {
+	if !isAdmin() {
+		return fail(errCodeUnauthorized, "admin only")
+	}
+
+	var params struct {
+		Symbol  string `json:"symbol"`
+		Enabled bool   `json:"enabled"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if !isAssetRegistered(params.Symbol) {
+		return fail(errCodeUnknownAsset, "unknown asset "+params.Symbol)
+	}
+
+	setAssetEnabled(params.Symbol, params.Enabled)
+
+	emitEvent(eventAssetUpdated, map[string]interface{}{
+		"symbol":  params.Symbol,
+		"enabled": params.Enabled,
+	})
+
+	return eventsResult()
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	sdk "dex-router/sdk"
 	"encoding/json"
 	"math"
 	"testing"
@@ -18,7 +19,10 @@ func TestAMMCalculations(t *testing.T) {
 		reserveOut := uint64(1000000) // 1000 HIVE
 		feeBps := uint64(8)           // 0.08%
 
-		amountOut := calculateSwapOutput(amountIn, reserveIn, reserveOut, feeBps, true)
+		amountOut, ok := calculateSwapOutput(amountIn, reserveIn, reserveOut, feeBps)
+		if !ok {
+			t.Fatalf("calculateSwapOutput() reported overflow")
+		}
 
 		// Expected: ~48685 (after 0.08% fee)
 		// Without fee: (100000 * 1000000) / (2000000 + 100000) = 100000000000 / 2100000 = 47619
@@ -39,9 +43,9 @@ func TestAMMCalculations(t *testing.T) {
 		feeBps := uint64(0)
 
 		// Small swap: 1% of reserves
-		smallSwap := calculateSwapOutput(10000, reserveIn, reserveOut, feeBps, true)
+		smallSwap, _ := calculateSwapOutput(10000, reserveIn, reserveOut, feeBps)
 		// Large swap: 50% of reserves
-		largeSwap := calculateSwapOutput(500000, reserveIn, reserveOut, feeBps, true)
+		largeSwap, _ := calculateSwapOutput(500000, reserveIn, reserveOut, feeBps)
 
 		// Large swap should give worse price due to slippage
 		priceImpactRatio := float64(largeSwap) / float64(smallSwap*50)
@@ -83,6 +87,44 @@ func TestSlippageProtection(t *testing.T) {
 	}
 }
 
+func TestSpotPriceSlippage(t *testing.T) {
+	// 2000 HBD : 1000 HIVE pool, 99920 HBD in after fee
+	// Spot expectation: 99920 * 1000000 / 2000000 = 49960, executed: 47582 (~4.76% short)
+	reserveIn, reserveOut := uint64(2000000), uint64(1000000)
+	amountInAfterFee := uint64(99920)
+	actualOut, _ := calculateSwapOutput(amountInAfterFee, reserveIn, reserveOut, 0)
+
+	expectedOut := spotAmountOut(amountInAfterFee, reserveIn, reserveOut)
+	if expectedOut != 49960 {
+		t.Fatalf("spotAmountOut() = %v, want 49960", expectedOut)
+	}
+
+	tests := []struct {
+		name        string
+		slippageBps int
+		exceeded    bool
+	}{
+		{"0.5% tolerance", 50, true},
+		{"4% tolerance", 400, true},
+		{"5% tolerance", 500, false},
+		{"100% tolerance", 10000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exceedsSlippage(expectedOut, actualOut, tt.slippageBps); got != tt.exceeded {
+				t.Errorf("exceedsSlippage(%v, %v, %v) = %v, want %v", expectedOut, actualOut, tt.slippageBps, got, tt.exceeded)
+			}
+		})
+	}
+
+	t.Run("Output at or above quote", func(t *testing.T) {
+		if exceedsSlippage(1000, 1000, 0) || exceedsSlippage(1000, 1001, 0) {
+			t.Errorf("exceedsSlippage() should not fire when output meets the quote")
+		}
+	})
+}
+
 func TestFeeCalculations(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -160,6 +202,7 @@ func TestJSONValidation(t *testing.T) {
 				"asset_in": "HBD",
 				"asset_out": "HIVE",
 				"recipient": "alice",
+				"amount_in": 5000,
 				"min_amount_out": 1000
 			}`,
 			false,
@@ -263,14 +306,57 @@ func TestLiquidityMath(t *testing.T) {
 	})
 }
 
+func TestValidateSwapPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      []string
+		assetIn   string
+		assetOut  string
+		shouldErr bool
+	}{
+		{"Direct pair", []string{"HBD", "HIVE"}, "HBD", "HIVE", false},
+		{"Route through HIVE", []string{"BTC", "HIVE", "HBD"}, "BTC", "HBD", false},
+		{"Max hops", []string{"A", "B", "C", "D", "E"}, "A", "E", false},
+		{"Too many hops", []string{"A", "B", "C", "D", "E", "F"}, "A", "F", true},
+		{"Wrong start", []string{"HIVE", "HBD"}, "BTC", "HBD", true},
+		{"Wrong end", []string{"BTC", "HIVE"}, "BTC", "HBD", true},
+		{"Single asset", []string{"BTC"}, "BTC", "BTC", true},
+		{"Repeated asset", []string{"BTC", "BTC", "HBD"}, "BTC", "HBD", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errMsg := validateSwapPath(tt.path, tt.assetIn, tt.assetOut)
+			if (errMsg != nil) != tt.shouldErr {
+				t.Errorf("validateSwapPath(%v) error = %v, want error %v", tt.path, errMsg, tt.shouldErr)
+			}
+		})
+	}
+}
+
+func TestPairKey(t *testing.T) {
+	if pairKey("HBD", "HIVE", 30) != "pair/HBD/HIVE/30" {
+		t.Errorf("pairKey(HBD, HIVE, 30) = %v, want pair/HBD/HIVE/30", pairKey("HBD", "HIVE", 30))
+	}
+	if pairKey("HIVE", "HBD", 30) != pairKey("HBD", "HIVE", 30) {
+		t.Errorf("pairKey should be independent of asset order")
+	}
+	if pairKey("HBD", "HIVE", 5) == pairKey("HBD", "HIVE", 30) {
+		t.Errorf("pairKey should differ between fee tiers")
+	}
+	if pairTiersKey("HIVE", "HBD") != "pair/HBD/HIVE/tiers" {
+		t.Errorf("pairTiersKey(HIVE, HBD) = %v, want pair/HBD/HIVE/tiers", pairTiersKey("HIVE", "HBD"))
+	}
+}
+
 func TestMathFunctions(t *testing.T) {
 	t.Run("sqrt128", func(t *testing.T) {
 		// Test sqrt(1000000 * 500000) = sqrt(500000000000) ≈ 707106
-		result := sqrt128(500000000000, 0)
+		result := sqrt128(0, 500000000000)
 		expected := uint64(707106)
 
 		if result != expected {
-			t.Errorf("sqrt128(500000000000, 0) = %v, want %v", result, expected)
+			t.Errorf("sqrt128(0, 500000000000) = %v, want %v", result, expected)
 		}
 	})
 
@@ -292,3 +378,239 @@ func TestMathFunctions(t *testing.T) {
 		}
 	})
 }
+
+func TestEventsResult(t *testing.T) {
+	if eventsResult() != nil {
+		t.Fatalf("eventsResult() with no events should be nil")
+	}
+
+	emitEvent(eventSwapExecuted, map[string]interface{}{
+		"pool_id":    "1",
+		"amount_in":  uint64(1000),
+		"amount_out": uint64(450),
+		"reserve0":   uint64(3000),
+		"reserve1":   uint64(1550),
+	})
+	emitEvent(eventLpMinted, map[string]interface{}{"pool_id": "1", "amount": uint64(10)})
+
+	result := eventsResult()
+	if result == nil {
+		t.Fatalf("eventsResult() should return the queued events")
+	}
+
+	var envelope struct {
+		V      int                      `json:"v"`
+		Events []map[string]interface{} `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(*result), &envelope); err != nil {
+		t.Fatalf("events result is not valid JSON: %v", err)
+	}
+	if envelope.V != eventVersion || len(envelope.Events) != 2 {
+		t.Fatalf("unexpected envelope: %s", *result)
+	}
+	if envelope.Events[0]["type"] != eventSwapExecuted || envelope.Events[0]["reserve1"] != float64(1550) {
+		t.Errorf("unexpected swap event: %v", envelope.Events[0])
+	}
+	if envelope.Events[1]["type"] != eventLpMinted || envelope.Events[1]["v"] != float64(eventVersion) {
+		t.Errorf("unexpected mint event: %v", envelope.Events[1])
+	}
+
+	if eventsResult() != nil {
+		t.Errorf("eventsResult() should reset the queue")
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	page := func(s string) *string { return &s }
+	tests := []struct {
+		name          string
+		payload       *string
+		offset, limit uint64
+		shouldErr     bool
+	}{
+		{"No payload", nil, 0, defaultPageLimit, false},
+		{"Empty payload", page(""), 0, defaultPageLimit, false},
+		{"Offset and limit", page(`{"offset": 10, "limit": 5}`), 10, 5, false},
+		{"Limit capped", page(`{"limit": 1000}`), 0, maxPageLimit, false},
+		{"Invalid JSON", page(`{offset}`), 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, limit, errMsg := parsePage(tt.payload)
+			if (errMsg != nil) != tt.shouldErr {
+				t.Fatalf("parsePage() error = %v, want error %v", errMsg, tt.shouldErr)
+			}
+			if !tt.shouldErr && (offset != tt.offset || limit != tt.limit) {
+				t.Errorf("parsePage() = (%v, %v), want (%v, %v)", offset, limit, tt.offset, tt.limit)
+			}
+		})
+	}
+}
+
+func TestIntentLimit(t *testing.T) {
+	allow := func(token, limit string) sdk.Intent {
+		return sdk.Intent{Type: "transfer.allow", Args: map[string]string{"token": token, "limit": limit}}
+	}
+	tests := []struct {
+		name      string
+		intents   []sdk.Intent
+		limit     uint64
+		found, ok bool
+	}{
+		{"No intents", nil, 0, false, false},
+		{"Matching intent", []sdk.Intent{allow("HBD", "1.500")}, 1500, true, true},
+		{"Other token only", []sdk.Intent{allow("HIVE", "1.000")}, 0, false, false},
+		{"Token is case-sensitive", []sdk.Intent{allow("hbd", "1.000")}, 0, false, false},
+		{"Other intent type", []sdk.Intent{{Type: "transfer.deny", Args: map[string]string{"token": "HBD", "limit": "1.000"}}}, 0, false, false},
+		{"Missing limit skipped", []sdk.Intent{{Type: "transfer.allow", Args: map[string]string{"token": "HBD"}}, allow("HBD", "0.200")}, 200, true, true},
+		{"First intent wins", []sdk.Intent{allow("HBD", "0.100"), allow("HBD", "9.000")}, 100, true, true},
+		{"Malformed limit", []sdk.Intent{allow("HBD", "1.5")}, 0, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, found, ok := intentLimit(tt.intents, "HBD")
+			if limit != tt.limit || found != tt.found || ok != tt.ok {
+				t.Errorf("intentLimit() = (%v, %v, %v), want (%v, %v, %v)", limit, found, ok, tt.limit, tt.found, tt.ok)
+			}
+		})
+	}
+	// BTC limits use the same three decimals in satoshis, not BTC's own 8
+	btc := []sdk.Intent{allow("BTC", "100.000")}
+	if limit, found, ok := intentLimit(btc, "BTC"); limit != 100000 || !found || !ok {
+		t.Errorf("intentLimit(BTC) = (%v, %v, %v), want (100000, true, true)", limit, found, ok)
+	}
+	btc = []sdk.Intent{allow("BTC", "0.00100000")}
+	if limit, found, ok := intentLimit(btc, "BTC"); limit != 0 || !found || ok {
+		t.Errorf("intentLimit(BTC, 8 decimals) = (%v, %v, %v), want (0, true, false)", limit, found, ok)
+	}
+}
+
+func TestParseIntentLimit(t *testing.T) {
+	tests := []struct {
+		raw   string
+		limit uint64
+		ok    bool
+	}{
+		{"1.000", 1000, true},
+		{"0.001", 1, true},
+		{"1000000.000", 1000000000, true},
+		{"9223372036854775.807", math.MaxInt64, true},
+		{"9223372036854775.808", 0, false},
+		{"1", 0, false},
+		{"1.00", 0, false},
+		{"1.0000", 0, false},
+		{".500", 0, false},
+		{"-1.000", 0, false},
+		{"+1.000", 0, false},
+		{"1.0a0", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			limit, ok := parseIntentLimit(tt.raw)
+			if limit != tt.limit || ok != tt.ok {
+				t.Errorf("parseIntentLimit(%q) = (%v, %v), want (%v, %v)", tt.raw, limit, ok, tt.limit, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFormatIntentLimit(t *testing.T) {
+	tests := []struct {
+		amount uint64
+		want   string
+	}{
+		{0, "0.000"},
+		{1, "0.001"},
+		{999, "0.999"},
+		{1000, "1.000"},
+		{1234567, "1234.567"},
+		{math.MaxInt64, "9223372036854775.807"},
+	}
+
+	for _, tt := range tests {
+		got := formatIntentLimit(tt.amount)
+		if got != tt.want {
+			t.Errorf("formatIntentLimit(%d) = %q, want %q", tt.amount, got, tt.want)
+		}
+		if limit, ok := parseIntentLimit(got); !ok || limit != tt.amount {
+			t.Errorf("parseIntentLimit(%q) = (%v, %v), want (%v, true)", got, limit, ok, tt.amount)
+		}
+	}
+}
+
+func TestCheckReturnAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		ret   *ReturnAddress
+		asset string
+		code  string
+	}{
+		{"No return address", nil, "HBD", ""},
+		{"Hive refunds any asset", &ReturnAddress{Chain: "HIVE", Address: "hive:carol"}, "HBD", ""},
+		{"BTC refunds BTC", &ReturnAddress{Chain: "BTC", Address: "bc1q"}, "BTC", ""},
+		{"BTC refunds only BTC", &ReturnAddress{Chain: "BTC", Address: "bc1q"}, "HIVE", "E_RETURN_ADDRESS"},
+		{"Unsupported chain", &ReturnAddress{Chain: "ETH", Address: "0x123"}, "HBD", "E_RETURN_ADDRESS"},
+		{"Missing address", &ReturnAddress{Chain: "HIVE"}, "HBD", "E_INVALID_PAYLOAD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := decodeError(checkReturnAddress(tt.ret, tt.asset))
+			if got.Code != tt.code {
+				t.Errorf("checkReturnAddress() code = %q, want %q", got.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestDeadlinePassed(t *testing.T) {
+	height := func(h uint64) *uint64 { return &h }
+	stamp := func(s string) *string { return &s }
+	tests := []struct {
+		name     string
+		deadline Deadline
+		passed   bool
+		ok       bool
+	}{
+		{"No bound", Deadline{}, false, false},
+		{"Height ahead", Deadline{BlockHeight: height(101)}, false, true},
+		{"Height is inclusive", Deadline{BlockHeight: height(100)}, false, true},
+		{"Height behind", Deadline{BlockHeight: height(99)}, true, true},
+		{"Timestamp ahead", Deadline{Timestamp: stamp("2025-01-01T00:08:00Z")}, false, true},
+		{"Timestamp is inclusive", Deadline{Timestamp: stamp("2025-01-01T00:07:00")}, false, true},
+		{"Timestamp behind", Deadline{Timestamp: stamp("2025-01-01T00:06:59Z")}, true, true},
+		{"Timestamp with offset", Deadline{Timestamp: stamp("2025-01-01T01:06:00+01:00")}, true, true},
+		{"Either bound expires", Deadline{BlockHeight: height(200), Timestamp: stamp("2025-01-01T00:00:00Z")}, true, true},
+		{"Malformed timestamp", Deadline{Timestamp: stamp("tomorrow")}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passed, ok := deadlinePassed(tt.deadline, 100, "2025-01-01T00:07:00")
+			if passed != tt.passed || ok != tt.ok {
+				t.Errorf("deadlinePassed() = (%v, %v), want (%v, %v)", passed, ok, tt.passed, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFail(t *testing.T) {
+	result := fail(errCodePoolNotFound, `no pool found for "HBD"/HIVE`)
+	if want := `{"error":"E_POOL_NOT_FOUND","message":"no pool found for \"HBD\"/HIVE"}`; *result != want {
+		t.Errorf("fail() = %s, want %s", *result, want)
+	}
+
+	e, ok := decodeError(result)
+	if !ok || e.Code != errCodePoolNotFound || e.Message != `no pool found for "HBD"/HIVE` {
+		t.Errorf("decodeError() = (%+v, %v)", e, ok)
+	}
+
+	for _, other := range []*string{nil, eventsResult(), jsonResult(map[string]string{"pool_id": "1"})} {
+		if _, ok := decodeError(other); ok {
+			t.Errorf("decodeError(%v) ok for a non-error result", other)
+		}
+	}
+}
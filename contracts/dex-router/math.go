@@ -0,0 +1,397 @@
+package main
+
+import "math/bits"
+
+// Overflow-safe AMM arithmetic. Every product of two uint64 amounts is taken
+// in 128 bits with bits.Mul64 and reduced with bits.Div64, so reserves can
+// use the full uint64 range without the intermediate k = r0 * r1 wrapping.
+
+const bpsDenominator = 10000
+
+// mulDiv returns floor(a * b / d). ok is false when d is zero or the
+// quotient does not fit in 64 bits.
+func mulDiv(a, b, d uint64) (uint64, bool) {
+	if d == 0 {
+		return 0, false
+	}
+	hi, lo := bits.Mul64(a, b)
+	if hi >= d {
+		return 0, false
+	}
+	q, _ := bits.Div64(hi, lo, d)
+	return q, true
+}
+
+// addU64 returns a + b. ok is false on overflow.
+func addU64(a, b uint64) (uint64, bool) {
+	sum, carry := bits.Add64(a, b, 0)
+	return sum, carry == 0
+}
+
+// applyFeeBps returns the part of amount left after deducting feeBps.
+func applyFeeBps(amount, feeBps uint64) uint64 {
+	if feeBps >= bpsDenominator {
+		return 0
+	}
+	// amount * (10000 - fee) / 10000 is never larger than amount
+	net, _ := mulDiv(amount, bpsDenominator-feeBps, bpsDenominator)
+	return net
+}
+
+// feeFromBps returns the fee deducted from amount at feeBps.
+func feeFromBps(amount, feeBps uint64) uint64 {
+	return amount - applyFeeBps(amount, feeBps)
+}
+
+// splitFee divides a swap fee into the part left in the pool for LPs and
+// the part accrued to the protocol at protocolShareBps.
+func splitFee(fee, protocolShareBps uint64) (lpFee, protocolFee uint64) {
+	if protocolShareBps >= bpsDenominator {
+		return 0, fee
+	}
+	// fee * share / 10000 is never larger than fee
+	protocolFee, _ = mulDiv(fee, protocolShareBps, bpsDenominator)
+	return fee - protocolFee, protocolFee
+}
+
+// calculateSwapOutput returns the constant-product output for amountIn after
+// the pool fee: dy = dx * rOut / (rIn + dx), rounded down in favour of the pool.
+// ok is false when the reserves are empty or the new input reserve overflows.
+func calculateSwapOutput(amountIn, reserveIn, reserveOut, feeBps uint64) (uint64, bool) {
+	if reserveIn == 0 || reserveOut == 0 {
+		return 0, false
+	}
+	amountInAfterFee := applyFeeBps(amountIn, feeBps)
+	newReserveIn, ok := addU64(reserveIn, amountInAfterFee)
+	if !ok {
+		return 0, false
+	}
+	// The quotient is strictly less than reserveOut, so it always fits
+	return mulDiv(amountInAfterFee, reserveOut, newReserveIn)
+}
+
+// swapResult is the outcome of one constant-product swap against a pool
+type swapResult struct {
+	AmountOut   uint64
+	Fee         uint64
+	ProtocolFee uint64
+	// Reserves after the swap; the LP share of the fee stays in the pool
+	ReserveIn  uint64
+	ReserveOut uint64
+	// Slippage surcharge held back from the output, and the part of it
+	// accrued to the protocol; the rest stays in the pool
+	SlipFee         uint64
+	SlipProtocolFee uint64
+}
+
+// swapStep swaps amountIn against reserves reserveIn/reserveOut. The input
+// net of the protocol's share of the fee joins the pool. ok is false when the
+// reserves are empty or the new input reserve overflows.
+func swapStep(amountIn, reserveIn, reserveOut, feeBps, protocolShareBps uint64) (swapResult, bool) {
+	amountOut, ok := calculateSwapOutput(amountIn, reserveIn, reserveOut, feeBps)
+	if !ok {
+		return swapResult{}, false
+	}
+	return settleSwap(amountIn, amountOut, reserveIn, reserveOut, feeBps, protocolShareBps)
+}
+
+// settleSwap charges the fee on amountIn and returns the reserves after
+// paying out amountOut, which must not exceed reserveOut
+func settleSwap(amountIn, amountOut, reserveIn, reserveOut, feeBps, protocolShareBps uint64) (swapResult, bool) {
+	fee := feeFromBps(amountIn, feeBps)
+	_, protocolFee := splitFee(fee, protocolShareBps)
+	newReserveIn, ok := addU64(reserveIn, amountIn-protocolFee)
+	if !ok {
+		return swapResult{}, false
+	}
+	return swapResult{
+		AmountOut:   amountOut,
+		Fee:         fee,
+		ProtocolFee: protocolFee,
+		ReserveIn:   newReserveIn,
+		ReserveOut:  reserveOut - amountOut,
+	}, true
+}
+
+// Pool types: the invariant a pool prices swaps on
+const (
+	poolTypeConstantProduct = "constant_product"
+	poolTypeStableSwap      = "stableswap"
+)
+
+// poolCurve is what a swap through a pool in one direction needs: the pool's
+// invariant and fee parameters
+type poolCurve struct {
+	Type             string
+	FeeBps           uint64
+	ProtocolShareBps uint64
+	// Stable pools only: amplification coefficient and the factors scaling
+	// each side's amounts to common decimals (see stableswap.go)
+	Amp     uint64
+	RateIn  uint64
+	RateOut uint64
+	// Slippage surcharge: price impact above SlipBaselineBps is charged on
+	// the output, SlipShareBps of it to the protocol (see slippageFee)
+	SlipBaselineBps uint64
+	SlipShareBps    uint64
+}
+
+// swap swaps amountIn against reserves reserveIn/reserveOut on the curve's
+// invariant, less any slippage surcharge; see swapStep
+func (c poolCurve) swap(amountIn, reserveIn, reserveOut uint64) (swapResult, bool) {
+	var res swapResult
+	var ok bool
+	if c.Type != poolTypeStableSwap {
+		res, ok = swapStep(amountIn, reserveIn, reserveOut, c.FeeBps, c.ProtocolShareBps)
+	} else {
+		amountOut, outOk := stableSwapOutput(amountIn, reserveIn, reserveOut, c)
+		if !outOk {
+			return swapResult{}, false
+		}
+		res, ok = settleSwap(amountIn, amountOut, reserveIn, reserveOut, c.FeeBps, c.ProtocolShareBps)
+	}
+	if !ok || c.SlipBaselineBps == 0 {
+		return res, ok
+	}
+
+	spotOut := c.spotAmountOut(applyFeeBps(amountIn, c.FeeBps), reserveIn, reserveOut)
+	slipFee := slippageFee(spotOut, res.AmountOut, c.SlipBaselineBps)
+	lpShare, protocolShare := splitFee(slipFee, c.SlipShareBps)
+	res.AmountOut -= slipFee
+	res.ReserveOut += lpShare
+	res.SlipFee, res.SlipProtocolFee = slipFee, protocolShare
+	return res, true
+}
+
+// spotAmountOut values amountIn at the curve's marginal price
+func (c poolCurve) spotAmountOut(amountIn, reserveIn, reserveOut uint64) uint64 {
+	if c.Type != poolTypeStableSwap {
+		return spotAmountOut(amountIn, reserveIn, reserveOut)
+	}
+	return stableSpotAmountOut(amountIn, reserveIn, reserveOut, c)
+}
+
+// priceX64 returns the curve's marginal price of the input asset in units of
+// the output asset as an unsigned 64.64 fixed-point number
+func (c poolCurve) priceX64(reserveIn, reserveOut uint64) u128 {
+	if c.Type != poolTypeStableSwap {
+		return priceX64(reserveIn, reserveOut)
+	}
+	return stablePriceX64(reserveIn, reserveOut, c)
+}
+
+// zapSwapAmount returns how much of a single-sided deposit of amount to swap
+// so that the rest and the swap output match the pool ratio after the swap.
+// It is the largest swap that leaves at least as much input as that ratio
+// needs, found by bisection over the curve's swap.
+func zapSwapAmount(amount, reserveIn, reserveOut uint64, curve poolCurve) uint64 {
+	lo, hi := uint64(0), amount
+	for lo < hi {
+		mid := hi - (hi-lo)/2
+		res, ok := curve.swap(mid, reserveIn, reserveOut)
+		// Keep the input side at or above the ratio: rest/out >= reserveIn/reserveOut
+		if ok && !mulLess(amount-mid, res.ReserveOut, res.AmountOut, res.ReserveIn) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// mulLess reports whether a*b < c*d, compared in 128 bits
+func mulLess(a, b, c, d uint64) bool {
+	lh, ll := bits.Mul64(a, b)
+	rh, rl := bits.Mul64(c, d)
+	return lh < rh || (lh == rh && ll < rl)
+}
+
+// spotAmountOut returns amountIn valued at the marginal price reserveOut/reserveIn,
+// i.e. the output a swap of that size would get with zero price impact
+func spotAmountOut(amountIn, reserveIn, reserveOut uint64) uint64 {
+	q, ok := mulDiv(amountIn, reserveOut, reserveIn)
+	if !ok {
+		if reserveIn == 0 {
+			return 0
+		}
+		return ^uint64(0)
+	}
+	return q
+}
+
+// exceedsSlippage reports whether actualOut falls more than slippageBps below expectedOut
+func exceedsSlippage(expectedOut, actualOut uint64, slippageBps int) bool {
+	if actualOut >= expectedOut {
+		return false
+	}
+	shortfall := expectedOut - actualOut
+	// shortfall/expectedOut > slippageBps/10000, compared in 128 bits
+	lh, ll := bits.Mul64(shortfall, bpsDenominator)
+	rh, rl := bits.Mul64(expectedOut, uint64(slippageBps))
+	return lh > rh || (lh == rh && ll > rl)
+}
+
+// priceImpactBps returns how far actualOut falls below expectedOut, in
+// basis points of expectedOut
+func priceImpactBps(expectedOut, actualOut uint64) uint64 {
+	if expectedOut == 0 || actualOut >= expectedOut {
+		return 0
+	}
+	impact, _ := mulDiv(expectedOut-actualOut, bpsDenominator, expectedOut)
+	return impact
+}
+
+// slippageFee returns the surcharge on amountOut for a swap whose output at
+// the spot price would be spotOut: the price impact in excess of baselineBps,
+// as the same share of amountOut. A zero baseline turns the surcharge off.
+func slippageFee(spotOut, amountOut, baselineBps uint64) uint64 {
+	impact := priceImpactBps(spotOut, amountOut)
+	if baselineBps == 0 || impact <= baselineBps {
+		return 0
+	}
+	// The excess is below 10000 bps, so the fee is less than amountOut
+	fee, _ := mulDiv(amountOut, impact-baselineBps, bpsDenominator)
+	return fee
+}
+
+// initialLiquidity returns the LP minted by the first deposit: floor(sqrt(amt0 * amt1)).
+func initialLiquidity(amt0, amt1 uint64) uint64 {
+	hi, lo := bits.Mul64(amt0, amt1)
+	return sqrt128(hi, lo)
+}
+
+// proportionalLiquidity returns the LP minted for depositing amount into a
+// pool side holding reserve, given totalLP outstanding.
+func proportionalLiquidity(amount, reserve, totalLP uint64) (uint64, bool) {
+	return mulDiv(amount, totalLP, reserve)
+}
+
+// optimalDeposit returns the largest amounts within max0 and max1 that match
+// the pool ratio reserve0:reserve1. ok is false when the ratio cannot be
+// computed. An empty pool takes both amounts as offered.
+func optimalDeposit(max0, max1, reserve0, reserve1 uint64) (amt0, amt1 uint64, ok bool) {
+	if reserve0 == 0 || reserve1 == 0 {
+		return max0, max1, true
+	}
+	if need1, fits := mulDiv(max0, reserve1, reserve0); fits && need1 <= max1 {
+		return max0, need1, true
+	}
+	// max1 binds, so the matching amount0 is at most max0
+	need0, fits := mulDiv(max1, reserve0, reserve1)
+	if !fits {
+		return 0, 0, false
+	}
+	return need0, max1, true
+}
+
+// withdrawalAmount returns the share of reserve redeemed by burning lpAmount
+// out of totalLP. lpAmount <= totalLP keeps the result within reserve.
+func withdrawalAmount(lpAmount, reserve, totalLP uint64) (uint64, bool) {
+	return mulDiv(reserve, lpAmount, totalLP)
+}
+
+// sqrt128 returns floor(sqrt(hi:lo)) where hi:lo is a 128-bit unsigned integer
+func sqrt128(hi, lo uint64) uint64 {
+	var low, high uint64 = 0, ^uint64(0)
+	var ans uint64
+	for low <= high {
+		mid := low + (high-low)>>1
+		mh, ml := bits.Mul64(mid, mid)
+		if mh < hi || (mh == hi && ml <= lo) {
+			ans = mid
+			if mid == ^uint64(0) {
+				break
+			}
+			low = mid + 1
+		} else {
+			if mid == 0 {
+				break
+			}
+			high = mid - 1
+		}
+	}
+	return ans
+}
+
+// u128 is an unsigned 128-bit integer. Its arithmetic wraps modulo 2^128,
+// which keeps differences of the price accumulators exact across overflow.
+type u128 struct {
+	Hi, Lo uint64
+}
+
+func (a u128) add(b u128) u128 {
+	lo, carry := bits.Add64(a.Lo, b.Lo, 0)
+	hi, _ := bits.Add64(a.Hi, b.Hi, carry)
+	return u128{hi, lo}
+}
+
+func (a u128) sub(b u128) u128 {
+	lo, borrow := bits.Sub64(a.Lo, b.Lo, 0)
+	hi, _ := bits.Sub64(a.Hi, b.Hi, borrow)
+	return u128{hi, lo}
+}
+
+func (a u128) mul64(m uint64) u128 {
+	hi, lo := bits.Mul64(a.Lo, m)
+	return u128{hi + a.Hi*m, lo}
+}
+
+// divmod64 returns a / d and a % d; d must be non-zero
+func (a u128) divmod64(d uint64) (u128, uint64) {
+	qHi, r := a.Hi/d, a.Hi%d
+	qLo, r := bits.Div64(r, a.Lo, d)
+	return u128{qHi, qLo}, r
+}
+
+func (a u128) isZero() bool {
+	return a.Hi == 0 && a.Lo == 0
+}
+
+// String formats a in decimal
+func (a u128) String() string {
+	if a.isZero() {
+		return "0"
+	}
+	var digits [39]byte
+	i := len(digits)
+	for !a.isZero() {
+		var r uint64
+		a, r = a.divmod64(10)
+		i--
+		digits[i] = byte('0' + r)
+	}
+	return string(digits[i:])
+}
+
+// parseU128 reads a decimal u128; values past 2^128 - 1 are rejected
+func parseU128(s string) (u128, bool) {
+	if s == "" {
+		return u128{}, false
+	}
+	var v u128
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return u128{}, false
+		}
+		carryHi, hiTimes10 := bits.Mul64(v.Hi, 10)
+		loHi, lo := bits.Mul64(v.Lo, 10)
+		hi, carry := bits.Add64(hiTimes10, loHi, 0)
+		if carryHi != 0 || carry != 0 {
+			return u128{}, false
+		}
+		lo, carry = bits.Add64(lo, uint64(c-'0'), 0)
+		hi, carry = bits.Add64(hi, 0, carry)
+		if carry != 0 {
+			return u128{}, false
+		}
+		v = u128{hi, lo}
+	}
+	return v, true
+}
+
+// priceX64 returns reserveOut / reserveIn as an unsigned 64.64 fixed-point
+// number, the price of the input asset in units of the output asset
+func priceX64(reserveIn, reserveOut uint64) u128 {
+	q, _ := u128{reserveOut, 0}.divmod64(reserveIn)
+	return q
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+const maxU64 = ^uint64(0)
+
+// bigMulDiv is the arbitrary-precision reference for floor(a * b / d)
+func bigMulDiv(a, b, d uint64) *big.Int {
+	n := new(big.Int).Mul(new(big.Int).SetUint64(a), new(big.Int).SetUint64(b))
+	return n.Quo(n, new(big.Int).SetUint64(d))
+}
+
+func TestMulDiv(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b, d  uint64
+		expected uint64
+		ok       bool
+	}{
+		{"Small values", 6, 7, 4, 10, true},
+		{"Product past 64 bits", maxU64, maxU64, maxU64, maxU64, true},
+		{"Max reserves ratio", maxU64, maxU64 - 1, maxU64, maxU64 - 1, true},
+		{"Quotient overflows", maxU64, 2, 1, 0, false},
+		{"Zero divisor", 1, 1, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := mulDiv(tt.a, tt.b, tt.d)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("mulDiv(%v, %v, %v) = (%v, %v), want (%v, %v)", tt.a, tt.b, tt.d, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMulDivMatchesBigInt(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		a, b, d := rng.Uint64(), rng.Uint64(), rng.Uint64()|1
+		want := bigMulDiv(a, b, d)
+		got, ok := mulDiv(a, b, d)
+		if ok != want.IsUint64() {
+			t.Fatalf("mulDiv(%v, %v, %v) ok = %v, want %v", a, b, d, ok, want.IsUint64())
+		}
+		if ok && got != want.Uint64() {
+			t.Fatalf("mulDiv(%v, %v, %v) = %v, want %v", a, b, d, got, want)
+		}
+	}
+}
+
+// Property: for any reserves up to the uint64 limit, a swap never pays out
+// more than the output reserve and never decreases k = reserveIn * reserveOut.
+func TestSwapOutputNoWraparound(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	check := func(amountIn, reserveIn, reserveOut, feeBps uint64) {
+		out, ok := calculateSwapOutput(amountIn, reserveIn, reserveOut, feeBps)
+		if !ok {
+			// Only allowed when the input reserve itself would overflow
+			if _, fits := addU64(reserveIn, applyFeeBps(amountIn, feeBps)); fits {
+				t.Fatalf("calculateSwapOutput(%v, %v, %v, %v) failed without overflow", amountIn, reserveIn, reserveOut, feeBps)
+			}
+			return
+		}
+		if out >= reserveOut {
+			t.Fatalf("calculateSwapOutput(%v, %v, %v, %v) = %v drains reserve %v", amountIn, reserveIn, reserveOut, feeBps, out, reserveOut)
+		}
+
+		kBefore := new(big.Int).Mul(new(big.Int).SetUint64(reserveIn), new(big.Int).SetUint64(reserveOut))
+		newIn := new(big.Int).SetUint64(reserveIn)
+		newIn.Add(newIn, new(big.Int).SetUint64(applyFeeBps(amountIn, feeBps)))
+		kAfter := new(big.Int).Mul(newIn, new(big.Int).SetUint64(reserveOut-out))
+		if kAfter.Cmp(kBefore) < 0 {
+			t.Fatalf("calculateSwapOutput(%v, %v, %v, %v) decreased k", amountIn, reserveIn, reserveOut, feeBps)
+		}
+	}
+
+	// Edge cases around the old 4.29e9 wraparound point and the uint64 limit
+	check(1000000, 5000000000, 5000000000, 8)
+	check(maxU64/2, maxU64/2, maxU64, 8)
+	check(maxU64, maxU64, maxU64, 0)
+	check(1, maxU64-1, maxU64, 30)
+	check(maxU64-1, 1, maxU64, 30)
+
+	for i := 0; i < 10000; i++ {
+		reserveIn := rng.Uint64()>>uint(rng.Intn(64)) | 1
+		reserveOut := rng.Uint64()>>uint(rng.Intn(64)) | 1
+		amountIn := rng.Uint64() >> uint(rng.Intn(64))
+		check(amountIn, reserveIn, reserveOut, uint64(rng.Intn(1000)))
+	}
+}
+
+func TestSwapOutputAtLargeReserves(t *testing.T) {
+	// 1e12 : 5e11 reserves overflow a 64-bit k by several orders of magnitude
+	reserveIn, reserveOut := uint64(1000000000000), uint64(500000000000)
+	amountIn := uint64(1000000000)
+
+	out, ok := calculateSwapOutput(amountIn, reserveIn, reserveOut, 0)
+	want := bigMulDiv(amountIn, reserveOut, reserveIn+amountIn).Uint64()
+	if !ok || out != want {
+		t.Errorf("calculateSwapOutput() = (%v, %v), want (%v, true)", out, ok, want)
+	}
+}
+
+func TestLiquidityMathNoWraparound(t *testing.T) {
+	t.Run("Initial liquidity at max amounts", func(t *testing.T) {
+		if got := initialLiquidity(maxU64, maxU64); got != maxU64 {
+			t.Errorf("initialLiquidity(max, max) = %v, want %v", got, maxU64)
+		}
+	})
+
+	t.Run("Initial liquidity is the floor square root", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(3))
+		for i := 0; i < 2000; i++ {
+			a, b := rng.Uint64(), rng.Uint64()
+			product := new(big.Int).Mul(new(big.Int).SetUint64(a), new(big.Int).SetUint64(b))
+			want := new(big.Int).Sqrt(product).Uint64()
+			if got := initialLiquidity(a, b); got != want {
+				t.Fatalf("initialLiquidity(%v, %v) = %v, want %v", a, b, got, want)
+			}
+		}
+	})
+
+	t.Run("Withdrawal never exceeds reserves", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(4))
+		for i := 0; i < 10000; i++ {
+			reserve, totalLP := rng.Uint64(), rng.Uint64()|1
+			lp := rng.Uint64() % (totalLP + 1)
+			out, ok := withdrawalAmount(lp, reserve, totalLP)
+			if !ok || out > reserve {
+				t.Fatalf("withdrawalAmount(%v, %v, %v) = (%v, %v)", lp, reserve, totalLP, out, ok)
+			}
+		}
+	})
+
+	t.Run("Proportional mint at large reserves", func(t *testing.T) {
+		// 10% of a 1e13 reserve against 1e13 LP would overflow a 64-bit product
+		minted, ok := proportionalLiquidity(1000000000000, 10000000000000, 10000000000000)
+		if !ok || minted != 1000000000000 {
+			t.Errorf("proportionalLiquidity() = (%v, %v), want (1000000000000, true)", minted, ok)
+		}
+	})
+}
+
+func TestFeeHelpers(t *testing.T) {
+	if got := applyFeeBps(maxU64, 30); got != bigMulDiv(maxU64, 9970, 10000).Uint64() {
+		t.Errorf("applyFeeBps(max, 30) = %v", got)
+	}
+	if got := feeFromBps(100000, 8); got != 80 {
+		t.Errorf("feeFromBps(100000, 8) = %v, want 80", got)
+	}
+	if got := applyFeeBps(100000, 10000); got != 0 {
+		t.Errorf("applyFeeBps(100000, 10000) = %v, want 0", got)
+	}
+}
+
+func TestSplitFee(t *testing.T) {
+	tests := []struct {
+		fee, share, lp, protocol uint64
+	}{
+		{80, 10000, 0, 80},
+		{80, 0, 80, 0},
+		{80, 2500, 60, 20},
+		{81, 5000, 41, 40}, // rounding favours LPs
+		{maxU64, 5000, maxU64 - maxU64/2, maxU64 / 2},
+	}
+	for _, tt := range tests {
+		lp, protocol := splitFee(tt.fee, tt.share)
+		if lp != tt.lp || protocol != tt.protocol {
+			t.Errorf("splitFee(%v, %v) = (%v, %v), want (%v, %v)", tt.fee, tt.share, lp, protocol, tt.lp, tt.protocol)
+		}
+		if lp+protocol != tt.fee {
+			t.Errorf("splitFee(%v, %v) does not add up to the fee", tt.fee, tt.share)
+		}
+	}
+}
+
+func TestPriceImpactBps(t *testing.T) {
+	tests := []struct {
+		expected, actual, want uint64
+	}{
+		{10000, 10000, 0},
+		{10000, 10500, 0},
+		{10000, 9900, 100},
+		{0, 0, 0},
+		{maxU64, maxU64 / 2, 5000},
+	}
+	for _, tt := range tests {
+		if got := priceImpactBps(tt.expected, tt.actual); got != tt.want {
+			t.Errorf("priceImpactBps(%v, %v) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+		}
+	}
+}
+
+func TestSlippageFee(t *testing.T) {
+	tests := []struct {
+		spotOut, amountOut, baselineBps, want uint64
+	}{
+		{100000, 90909, 0, 0},                        // off
+		{100000, 99500, 100, 0},                      // 50 bps impact, under the baseline
+		{100000, 99000, 100, 0},                      // at the baseline
+		{100000, 90909, 100, 7354},                   // 909 bps impact: 809 bps of 90909
+		{100000, 100500, 100, 0},                     // output above spot
+		{maxU64, maxU64 / 2, 1, 4610763681223702425}, // 128-bit intermediate
+	}
+	for _, tt := range tests {
+		if got := slippageFee(tt.spotOut, tt.amountOut, tt.baselineBps); got != tt.want {
+			t.Errorf("slippageFee(%v, %v, %v) = %v, want %v", tt.spotOut, tt.amountOut, tt.baselineBps, got, tt.want)
+		}
+	}
+}
+
+func TestSwapSlippageSurcharge(t *testing.T) {
+	plain := poolCurve{FeeBps: 0, ProtocolShareBps: 10000}
+	base, _ := plain.swap(100000, 1000000, 1000000)
+
+	// 909 bps impact against a 100 bps baseline, half of the surcharge to the protocol
+	curve := plain
+	curve.SlipBaselineBps, curve.SlipShareBps = 100, 5000
+	res, ok := curve.swap(100000, 1000000, 1000000)
+	if !ok {
+		t.Fatal("swap failed")
+	}
+	if res.SlipFee != 7354 || res.SlipProtocolFee != 3677 {
+		t.Errorf("surcharge = (%v, %v), want (7354, 3677)", res.SlipFee, res.SlipProtocolFee)
+	}
+	if res.AmountOut != base.AmountOut-res.SlipFee {
+		t.Errorf("amount out = %v, want %v", res.AmountOut, base.AmountOut-res.SlipFee)
+	}
+	// The LP part of the surcharge stays in the pool
+	if res.ReserveOut != base.ReserveOut+res.SlipFee-res.SlipProtocolFee {
+		t.Errorf("reserve out = %v, want %v", res.ReserveOut, base.ReserveOut+res.SlipFee-res.SlipProtocolFee)
+	}
+	if res.ReserveIn != base.ReserveIn {
+		t.Errorf("reserve in = %v, want %v", res.ReserveIn, base.ReserveIn)
+	}
+
+	// A small swap stays under the baseline and pays nothing extra
+	if res, _ := curve.swap(1000, 1000000, 1000000); res.SlipFee != 0 {
+		t.Errorf("small swap surcharge = %v, want 0", res.SlipFee)
+	}
+}
+
+func TestOptimalDeposit(t *testing.T) {
+	tests := []struct {
+		name               string
+		max0, max1, r0, r1 uint64
+		want0, want1       uint64
+	}{
+		{"Empty pool takes both", 1000, 7, 0, 0, 1000, 7},
+		{"Exact ratio", 200, 100, 2000000, 1000000, 200, 100},
+		{"Excess asset1 left undrawn", 100000, 100000, 2000000, 1000000, 100000, 50000},
+		{"Excess asset0 left undrawn", 100000, 10000, 2000000, 1000000, 20000, 10000},
+		{"Large reserves", maxU64 / 2, maxU64, maxU64, maxU64 / 2, maxU64 / 2, maxU64 / 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got0, got1, ok := optimalDeposit(tt.max0, tt.max1, tt.r0, tt.r1)
+			if !ok || got0 != tt.want0 || got1 != tt.want1 {
+				t.Errorf("optimalDeposit() = (%v, %v, %v), want (%v, %v)", got0, got1, ok, tt.want0, tt.want1)
+			}
+			if got0 > tt.max0 || got1 > tt.max1 {
+				t.Errorf("optimalDeposit() exceeds the offered amounts")
+			}
+		})
+	}
+}
+
+func TestZapSwapAmount(t *testing.T) {
+	tests := []struct {
+		name                          string
+		amount, reserveIn, reserveOut uint64
+		feeBps, protocolShareBps      uint64
+	}{
+		{"Small deposit", 100000, 1000000, 2000000, 8, 10000},
+		{"LP keeps fee", 100000, 1000000, 2000000, 30, 0},
+		{"Deposit larger than pool", 5000000, 1000000, 1000000, 30, 5000},
+		{"Large reserves", maxU64 / 8, maxU64 / 4, maxU64 / 2, 30, 10000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			curve := poolCurve{FeeBps: tt.feeBps, ProtocolShareBps: tt.protocolShareBps}
+			swapAmount := zapSwapAmount(tt.amount, tt.reserveIn, tt.reserveOut, curve)
+			if swapAmount == 0 || swapAmount >= tt.amount {
+				t.Fatalf("zapSwapAmount() = %v, want between 0 and %v", swapAmount, tt.amount)
+			}
+			res, ok := swapStep(swapAmount, tt.reserveIn, tt.reserveOut, tt.feeBps, tt.protocolShareBps)
+			if !ok {
+				t.Fatalf("swapStep failed for %v", swapAmount)
+			}
+
+			// The whole swap output is deposited and at most a rounding
+			// remainder of the input side is left over
+			rest := tt.amount - swapAmount
+			usedIn, usedOut, ok := optimalDeposit(rest, res.AmountOut, res.ReserveIn, res.ReserveOut)
+			if !ok || usedOut != res.AmountOut {
+				t.Errorf("swap output not fully deposited: used %v of %v", usedOut, res.AmountOut)
+			}
+			if leftover := rest - usedIn; leftover*10000 > tt.amount {
+				t.Errorf("leftover %v of %v exceeds 1 bps", leftover, tt.amount)
+			}
+		})
+	}
+}
+
+// bigU128 converts a u128 to its arbitrary-precision value
+func bigU128(v u128) *big.Int {
+	n := new(big.Int).Lsh(new(big.Int).SetUint64(v.Hi), 64)
+	return n.Or(n, new(big.Int).SetUint64(v.Lo))
+}
+
+func TestU128MatchesBigInt(t *testing.T) {
+	mod := new(big.Int).Lsh(big.NewInt(1), 128)
+	rng := rand.New(rand.NewSource(18))
+	for i := 0; i < 1000; i++ {
+		a := u128{rng.Uint64(), rng.Uint64()}
+		b := u128{rng.Uint64() >> uint(rng.Intn(64)), rng.Uint64()}
+		m := rng.Uint64() >> uint(rng.Intn(64))
+
+		sum := new(big.Int).Add(bigU128(a), bigU128(b))
+		if bigU128(a.add(b)).Cmp(sum.Mod(sum, mod)) != 0 {
+			t.Fatalf("%v + %v wrong", a, b)
+		}
+		diff := new(big.Int).Sub(bigU128(a), bigU128(b))
+		if bigU128(a.sub(b)).Cmp(diff.Mod(diff, mod)) != 0 {
+			t.Fatalf("%v - %v wrong", a, b)
+		}
+		prod := new(big.Int).Mul(bigU128(a), new(big.Int).SetUint64(m))
+		if bigU128(a.mul64(m)).Cmp(prod.Mod(prod, mod)) != 0 {
+			t.Fatalf("%v * %v wrong", a, m)
+		}
+		if m > 0 {
+			q, r := a.divmod64(m)
+			wantQ, wantR := new(big.Int).QuoRem(bigU128(a), new(big.Int).SetUint64(m), new(big.Int))
+			if bigU128(q).Cmp(wantQ) != 0 || r != wantR.Uint64() {
+				t.Fatalf("%v / %v wrong", a, m)
+			}
+		}
+
+		s := a.String()
+		if s != bigU128(a).String() {
+			t.Fatalf("String() = %v, want %v", s, bigU128(a))
+		}
+		if back, ok := parseU128(s); !ok || back != a {
+			t.Fatalf("parseU128(%v) = %v, %v", s, back, ok)
+		}
+	}
+}
+
+func TestParseU128Bounds(t *testing.T) {
+	max := u128{maxU64, maxU64}
+	if v, ok := parseU128(max.String()); !ok || v != max {
+		t.Errorf("parseU128(2^128-1) = %v, %v", v, ok)
+	}
+	for _, s := range []string{"", "340282366920938463463374607431768211456", "12a", "-1"} {
+		if _, ok := parseU128(s); ok {
+			t.Errorf("parseU128(%q) should fail", s)
+		}
+	}
+	if zero := (u128{}).String(); zero != "0" {
+		t.Errorf("zero String() = %v", zero)
+	}
+}
+
+func TestPriceX64(t *testing.T) {
+	// 2 units out per unit in is 2.0 in 64.64
+	if p := priceX64(1000, 2000); p != (u128{2, 0}) {
+		t.Errorf("priceX64(1000, 2000) = %v, want 2.0", p)
+	}
+	// 0.5 is half of 2^64 in the fractional word
+	if p := priceX64(2000, 1000); p != (u128{0, 1 << 63}) {
+		t.Errorf("priceX64(2000, 1000) = %v, want 0.5", p)
+	}
+	if p := priceX64(1, maxU64); p != (u128{maxU64, 0}) {
+		t.Errorf("priceX64(1, max) = %v, want max", p)
+	}
+}
+
+func stableCurve(amp, feeBps uint64) poolCurve {
+	return poolCurve{Type: poolTypeStableSwap, FeeBps: feeBps, ProtocolShareBps: 10000, Amp: amp, RateIn: 1, RateOut: 1}
+}
+
+func TestStableD(t *testing.T) {
+	// A balanced pool's invariant is the sum of its balances
+	for _, amp := range []uint64{1, 100, maxStableAmp} {
+		d, ok := stableD(big.NewInt(1000000), big.NewInt(1000000), amp)
+		if !ok || d.Cmp(big.NewInt(2000000)) != 0 {
+			t.Errorf("stableD(balanced, amp %v) = %v, %v, want 2000000", amp, d, ok)
+		}
+	}
+	// Away from balance D sits between the constant-product 2·sqrt(xy) and x + y
+	d, ok := stableD(big.NewInt(100000), big.NewInt(1900000), 100)
+	if !ok || d.Cmp(big.NewInt(2*436000)) <= 0 || d.Cmp(big.NewInt(2000000)) >= 0 {
+		t.Errorf("stableD(imbalanced) = %v, %v", d, ok)
+	}
+	if _, ok := stableD(big.NewInt(0), big.NewInt(1000), 100); ok {
+		t.Errorf("stableD with an empty balance should fail")
+	}
+}
+
+func TestStableSwapOutput(t *testing.T) {
+	tests := []struct {
+		name                            string
+		amountIn, reserveIn, reserveOut uint64
+		curve                           poolCurve
+		want                            uint64
+	}{
+		{"Balanced without fee", 10000, 1000000, 1000000, stableCurve(100, 0), 9999},
+		{"Balanced with fee", 10000, 1000000, 1000000, stableCurve(100, 8), 9991},
+		{"Ten percent of the pool", 100000, 1000000, 1000000, stableCurve(100, 4), 99909},
+		{"Mixed decimals", 1000, 1000000, 1000000000, poolCurve{Type: poolTypeStableSwap, Amp: 100, RateIn: 1000, RateOut: 1}, 999995},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := stableSwapOutput(tt.amountIn, tt.reserveIn, tt.reserveOut, tt.curve)
+			if !ok || got != tt.want {
+				t.Errorf("stableSwapOutput() = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+
+	// Near the peg the curve beats constant product by a wide margin
+	stable, _ := stableSwapOutput(100000, 1000000, 1000000, stableCurve(100, 4))
+	cp, _ := calculateSwapOutput(100000, 1000000, 1000000, 4)
+	if stable <= cp {
+		t.Errorf("stable output %v not above constant-product %v", stable, cp)
+	}
+
+	// The pool never pays out its whole reserve
+	got, ok := stableSwapOutput(maxU64/4, 1000000, 1000000, stableCurve(100, 0))
+	if !ok || got >= 1000000 {
+		t.Errorf("stableSwapOutput(huge) = %v, %v", got, ok)
+	}
+}
+
+func TestStableSwapKeepsInvariant(t *testing.T) {
+	rng := rand.New(rand.NewSource(19))
+	for i := 0; i < 200; i++ {
+		rIn := rng.Uint64()>>24 + 1000
+		rOut := rng.Uint64()>>24 + 1000
+		amountIn := rng.Uint64() >> uint(24+rng.Intn(30))
+		curve := stableCurve(uint64(rng.Intn(1000)+1), uint64(rng.Intn(100)))
+
+		res, ok := curve.swap(amountIn, rIn, rOut)
+		if !ok {
+			t.Fatalf("swap(%v, %v, %v) failed", amountIn, rIn, rOut)
+		}
+		before, _ := stableD(big.NewInt(int64(rIn)), big.NewInt(int64(rOut)), curve.Amp)
+		after, _ := stableD(new(big.Int).SetUint64(res.ReserveIn), new(big.Int).SetUint64(res.ReserveOut), curve.Amp)
+		if res.ReserveOut == 0 || after.Cmp(before) < 0 {
+			t.Fatalf("swap(%v, %v, %v) lowered D from %v to %v", amountIn, rIn, rOut, before, after)
+		}
+	}
+}
+
+func TestStablePriceX64(t *testing.T) {
+	if p := stablePriceX64(1000000, 1000000, stableCurve(100, 0)); p != (u128{1, 0}) {
+		t.Errorf("balanced price = %v, want 1.0", p)
+	}
+	// 1.000 of a 3-decimal asset is 1.000000 of a 6-decimal one at the peg
+	mixed := poolCurve{Type: poolTypeStableSwap, Amp: 100, RateIn: 1000, RateOut: 1}
+	if p := stablePriceX64(1000000, 1000000000, mixed); p != (u128{1000, 0}) {
+		t.Errorf("mixed-decimals price = %v, want 1000.0", p)
+	}
+	// The over-supplied side trades below the peg, but far closer to it than
+	// the reserve ratio
+	p := stablePriceX64(1500000, 500000, stableCurve(100, 0))
+	if p.Hi != 0 || p.Lo < 1<<63 {
+		t.Errorf("imbalanced price = %v, want between 0.5 and 1.0", p)
+	}
+}
+
+func TestStableLiquidity(t *testing.T) {
+	curve := stableCurve(100, 4)
+
+	// The first deposit mints D
+	if got, ok := stableLiquidity(0, 0, 1000000, 1000000, 0, curve); !ok || got != 2000000 {
+		t.Errorf("initial stableLiquidity() = %v, %v, want 2000000", got, ok)
+	}
+	if got, ok := stableLiquidity(0, 0, 1000000, 0, 0, curve); !ok || got != 0 {
+		t.Errorf("one-sided initial stableLiquidity() = %v, %v, want 0", got, ok)
+	}
+
+	// A proportional deposit pays no imbalance fee
+	if got, ok := stableLiquidity(1000000, 1000000, 1001000, 1001000, 2000000, curve); !ok || got != 2000 {
+		t.Errorf("proportional stableLiquidity() = %v, %v, want 2000", got, ok)
+	}
+
+	// A one-sided deposit mints a little less than its value at the peg
+	got, ok := stableLiquidity(1099960, 900091, 1199960, 900091, 2000000, curve)
+	if !ok || got != 99925 {
+		t.Errorf("one-sided stableLiquidity() = %v, %v, want 99925", got, ok)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	sdk "dex-router/sdk"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Price oracle
+//
+// Every pool keeps Uniswap v2 style cumulative prices: the sum, over blocks,
+// of its unsigned 64.64 fixed-point marginal prices, which for stable pools
+// come from the StableSwap curve rather than the reserve ratio. They are
+// advanced with the reserves in force before each reserve change, so a price
+// set in a block only starts counting from the next one. The accumulators
+// wrap modulo 2^128 and are stored as decimal strings, so other contracts can
+// read them through ContractStateGet:
+//
+//	pool/{poolId}/price0_cumulative  sum of the price of asset0 in asset1 (reserve1/reserve0)
+//	pool/{poolId}/price1_cumulative  sum of the price of asset1 in asset0 (reserve0/reserve1)
+//	pool/{poolId}/price_block        block height the sums were last advanced to
+//
+// The average price between two readings is the difference of the sums
+// divided by the blocks between them. The pool also keeps its last
+// twapObservations readings, one per block with a reserve change, so
+// get_twap can answer for a window without the caller storing readings:
+//
+//	pool/{poolId}/obs/{n % twapObservations} -> "block,price0_cumulative,price1_cumulative"
+//	pool/{poolId}/obs_count                  -> observations written so far
+
+const twapObservations = 128
+
+// priceObservation is the pair of accumulators at a block
+type priceObservation struct {
+	Block      uint64
+	Cumulative [2]u128
+}
+
+// updatePriceAccumulators advances a pool's cumulative prices to the current
+// block with its stored reserves. It must run before the reserves change.
+func updatePriceAccumulators(poolId string) {
+	now := sdk.GetEnv().BlockHeight
+	first := getStr(poolKey(poolId, keyPoolPriceBlock)) == ""
+	last := getUint(poolKey(poolId, keyPoolPriceBlock))
+	if !first && now <= last {
+		return
+	}
+
+	obs := priceObservation{Block: now, Cumulative: storedCumulative(poolId)}
+	r0, r1 := getPoolReserve0(poolId), getPoolReserve1(poolId)
+	if !first && r0 > 0 && r1 > 0 {
+		obs.Cumulative = accumulatePrices(poolId, obs.Cumulative, r0, r1, now-last)
+	}
+
+	setStr(poolKey(poolId, keyPoolPrice0Cumulative), obs.Cumulative[0].String())
+	setStr(poolKey(poolId, keyPoolPrice1Cumulative), obs.Cumulative[1].String())
+	setUint(poolKey(poolId, keyPoolPriceBlock), now)
+
+	count := getUint(poolKey(poolId, keyPoolObsCount))
+	setStr(poolObservationKey(poolId, count), formatObservation(obs))
+	setUint(poolKey(poolId, keyPoolObsCount), count+1)
+}
+
+// storedCumulative returns a pool's accumulators as last written
+func storedCumulative(poolId string) [2]u128 {
+	cum0, _ := parseU128(getStr(poolKey(poolId, keyPoolPrice0Cumulative)))
+	cum1, _ := parseU128(getStr(poolKey(poolId, keyPoolPrice1Cumulative)))
+	return [2]u128{cum0, cum1}
+}
+
+// currentObservation returns the accumulators extended to block now with
+// the current reserves, without writing them
+func currentObservation(poolId string, now uint64) priceObservation {
+	obs := priceObservation{Block: now, Cumulative: storedCumulative(poolId)}
+	last := getUint(poolKey(poolId, keyPoolPriceBlock))
+	r0, r1 := getPoolReserve0(poolId), getPoolReserve1(poolId)
+	if now > last && r0 > 0 && r1 > 0 {
+		obs.Cumulative = accumulatePrices(poolId, obs.Cumulative, r0, r1, now-last)
+	}
+	return obs
+}
+
+// accumulatePrices adds elapsed blocks at the pool's marginal prices for
+// reserves r0/r1 to the accumulators
+func accumulatePrices(poolId string, cumulative [2]u128, r0, r1, elapsed uint64) [2]u128 {
+	price0 := getPoolCurve(poolId, true).priceX64(r0, r1)
+	price1 := getPoolCurve(poolId, false).priceX64(r1, r0)
+	return [2]u128{
+		cumulative[0].add(price0.mul64(elapsed)),
+		cumulative[1].add(price1.mul64(elapsed)),
+	}
+}
+
+func poolObservationKey(poolId string, n uint64) string {
+	return poolKey(poolId, keyPoolObsPrefix+strconv.FormatUint(n%twapObservations, 10))
+}
+
+func formatObservation(obs priceObservation) string {
+	return strconv.FormatUint(obs.Block, 10) + "," + obs.Cumulative[0].String() + "," + obs.Cumulative[1].String()
+}
+
+func parseObservation(raw string) (priceObservation, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 3 {
+		return priceObservation{}, false
+	}
+	block, err := strconv.ParseUint(parts[0], 10, 64)
+	cum0, ok0 := parseU128(parts[1])
+	cum1, ok1 := parseU128(parts[2])
+	if err != nil || !ok0 || !ok1 {
+		return priceObservation{}, false
+	}
+	return priceObservation{Block: block, Cumulative: [2]u128{cum0, cum1}}, true
+}
+
+// observationAt returns the accumulators at block target, interpolated
+// between the stored observations around it. The price is constant between
+// observations, so the interpolation is exact.
+func observationAt(poolId string, target, now uint64) (priceObservation, bool) {
+	count := getUint(poolKey(poolId, keyPoolObsCount))
+	oldest := uint64(0)
+	if count > twapObservations {
+		oldest = count - twapObservations
+	}
+
+	// Binary search for the newest observation at or before target
+	lo, hi := oldest, count
+	var before priceObservation
+	found := false
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		obs, ok := parseObservation(getStr(poolObservationKey(poolId, mid)))
+		if !ok {
+			return priceObservation{}, false
+		}
+		if obs.Block <= target {
+			before, found = obs, true
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if !found {
+		return priceObservation{}, false
+	}
+	if before.Block == target {
+		return before, true
+	}
+
+	after := currentObservation(poolId, now)
+	if lo < count {
+		after, _ = parseObservation(getStr(poolObservationKey(poolId, lo)))
+	}
+
+	obs := priceObservation{Block: target}
+	span := after.Block - before.Block
+	for i := range obs.Cumulative {
+		rate, _ := after.Cumulative[i].sub(before.Cumulative[i]).divmod64(span)
+		obs.Cumulative[i] = before.Cumulative[i].add(rate.mul64(target - before.Block))
+	}
+	return obs, true
+}
+
+// x64ToFloat converts an unsigned 64.64 fixed-point number for display
+func x64ToFloat(v u128) float64 {
+	return float64(v.Hi) + float64(v.Lo)/(1<<64)
+}
+
+// Query a pool's time-weighted average prices over the last window blocks
+// Payload: JSON {"pool_id": "1", "window": 100}
+//
+//go:wasmexport get_twap
+func GetTwap(payload *string) *string {
+	var params struct {
+		PoolId string `json:"pool_id"`
+		Window uint64 `json:"window"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if getPoolAsset0(params.PoolId) == "" {
+		return fail(errCodePoolNotFound, "pool not found")
+	}
+
+	now := sdk.GetEnv().BlockHeight
+	if params.Window == 0 || params.Window > now {
+		return fail(errCodeInvalidParam, "invalid window")
+	}
+
+	start, ok := observationAt(params.PoolId, now-params.Window, now)
+	if !ok {
+		return fail(errCodePriceHistory, "insufficient price history for window")
+	}
+	end := currentObservation(params.PoolId, now)
+
+	price0, _ := end.Cumulative[0].sub(start.Cumulative[0]).divmod64(params.Window)
+	price1, _ := end.Cumulative[1].sub(start.Cumulative[1]).divmod64(params.Window)
+
+	return jsonResult(map[string]interface{}{
+		"pool_id":    params.PoolId,
+		"asset0":     getPoolAsset0(params.PoolId),
+		"asset1":     getPoolAsset1(params.PoolId),
+		"window":     params.Window,
+		"from_block": start.Block,
+		"to_block":   end.Block,
+		"price0_x64": price0.String(),
+		"price1_x64": price1.String(),
+		"price0":     x64ToFloat(price0),
+		"price1":     x64ToFloat(price1),
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	sdk "dex-router/sdk"
+	"encoding/json"
+)
+
+// Refunds
+//
+// A swap that cannot be filled (no pool or route, an empty or paused pool,
+// output below min_amount_out or beyond slippage_bps, an unknown or disabled
+// asset, a passed deadline) normally fails before anything is drawn, or
+// reverts. That leaves nothing to give back to a user
+// who signed the transaction, but a swap started by a cross-chain mapping
+// deposit has no user transaction to revert: the mapping contract calls
+// execute on the depositor's behalf. When the instruction has a
+// return_address, the contract instead draws amount_in and sends it there,
+// and the call succeeds with a swap_refunded event:
+//
+//	HIVE  transferred on the VSC ledger to the address
+//	BTC   unmapped through the chain's mapping contract to the Bitcoin address
+//
+// Mapping contracts are registered per chain with set_mapping_contract:
+//
+//	mapping/{chain} -> contract id
+//
+// and must export an unmap action taking {"to": address, "amount": n} that
+// draws n of the chain's mapped asset from the caller.
+
+const (
+	returnChainHive = "HIVE"
+	returnChainBtc  = "BTC"
+	mappingUnmap    = "unmap"
+)
+
+// Asset each mapped chain's refunds are paid out in
+var mappedChainAssets = map[string]string{
+	returnChainBtc: "BTC",
+}
+
+func mappingContractKey(chain string) string {
+	return keyMappingPrefix + chain
+}
+
+// checkReturnAddress validates an instruction's return address against the
+// asset it would refund
+func checkReturnAddress(ret *ReturnAddress, asset string) *string {
+	if ret == nil {
+		return nil
+	}
+	if ret.Address == "" {
+		return fail(errCodeInvalidPayload, "return_address.address required")
+	}
+	if ret.Chain == returnChainHive {
+		return nil
+	}
+	mapped, ok := mappedChainAssets[ret.Chain]
+	if !ok {
+		return fail(errCodeReturnAddress, "unsupported return_address chain "+ret.Chain)
+	}
+	if asset != mapped {
+		return fail(errCodeReturnAddress, ret.Chain+" return_address only refunds "+mapped)
+	}
+	return nil
+}
+
+// refundSwap returns a failed swap's amount_in to its return address and
+// reports the failure, a result from fail, in a swap_refunded event. Without
+// a return address it returns failure unchanged, as it does when nothing can
+// be drawn.
+func refundSwap(instruction DexInstruction, failure *string) *string {
+	ret := instruction.ReturnAddress
+	if ret == nil || instruction.AmountIn == nil || *instruction.AmountIn <= 0 {
+		return failure
+	}
+	amount := uint64(*instruction.AmountIn)
+	asset := instruction.AssetIn
+	reason, _ := decodeError(failure)
+
+	mapping := ""
+	if ret.Chain != returnChainHive {
+		mapping = getStr(mappingContractKey(ret.Chain))
+		if mapping == "" {
+			return fail(errCodeRefundUnavailable, "no "+ret.Chain+" mapping contract to refund through: "+reason.Message)
+		}
+	}
+	if errMsg := checkDraw(asset, amount); errMsg != nil {
+		return errMsg
+	}
+
+	drawAsset(int64(amount), asset)
+	if mapping == "" {
+		transferAsset(ret.Address, int64(amount), asset)
+	} else {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"to":     ret.Address,
+			"amount": amount,
+		})
+		sdk.ContractCall(mapping, mappingUnmap, string(payload), &sdk.ContractCallOptions{
+			Intents: []sdk.Intent{transferAllowIntent(asset, amount)},
+		})
+	}
+
+	emitEvent(eventSwapRefunded, map[string]interface{}{
+		"asset":   asset,
+		"amount":  amount,
+		"chain":   ret.Chain,
+		"address": ret.Address,
+		"reason":  reason.Code,
+		"message": reason.Message,
+	})
+	return nil
+}
+
+// refundRejectedSwap refunds a swap that execute rejects before routing it,
+// because it expired or names an unknown or disabled asset, and returns
+// execute's result: the refund's events, or failure without a return address
+func refundRejectedSwap(instruction DexInstruction, failure *string) *string {
+	if errMsg := checkReturnAddress(instruction.ReturnAddress, instruction.AssetIn); errMsg != nil {
+		return errMsg
+	}
+	if errMsg := refundSwap(instruction, failure); errMsg != nil {
+		return errMsg
+	}
+	return eventsResult()
+}
+
+// Register the mapping contract that refunds to a chain are unmapped through
+// (owner or admin); an empty contract_id removes it
+// Payload: JSON {"chain": "BTC", "contract_id": "vsc1..."}
+//
+//go:wasmexport set_mapping_contract
+func SetMappingContract(payload *string) *string {
+	if !isAdmin() {
+		return fail(errCodeUnauthorized, "admin only")
+	}
+
+	var params struct {
+		Chain      string `json:"chain"`
+		ContractId string `json:"contract_id"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil {
+		return fail(errCodeInvalidPayload, "invalid payload")
+	}
+	if _, ok := mappedChainAssets[params.Chain]; !ok {
+		return fail(errCodeInvalidParam, "unsupported chain "+params.Chain)
+	}
+
+	if params.ContractId == "" {
+		sdk.StateDeleteObject(mappingContractKey(params.Chain))
+	} else {
+		setStr(mappingContractKey(params.Chain), params.ContractId)
+	}
+
+	emitEvent(eventMappingContractSet, map[string]interface{}{
+		"chain":       params.Chain,
+		"contract_id": params.ContractId,
+	})
+
+	return eventsResult()
+}
@@ -0,0 +1,280 @@
+package main
+
+import "math/big"
+
+// StableSwap invariant
+//
+// Stable pools price swaps on Curve's StableSwap invariant for two coins,
+//
+//	Ann·(x + y) + D = Ann·D + D³ / (4·x·y),  Ann = A·n^n = 4A
+//
+// which is flat like x + y = D near balance and bends towards x·y = k as the
+// reserves drift apart; the amplification coefficient A sets how far the
+// flat region reaches. Both reserves are first scaled to the decimals of the
+// finer asset (see stableRates), so one whole unit of each is worth the same
+// at the peg. D³ needs close to 200 bits, so the invariant is computed with
+// math/big rather than the 128-bit helpers in math.go.
+
+const (
+	defaultStableAmp  = 100
+	maxStableAmp      = 1000000
+	stableMaxNewtonIt = 255
+)
+
+var (
+	bigOne   = big.NewInt(1)
+	bigThree = big.NewInt(3)
+)
+
+// stableRates returns the factors scaling amounts with decimals0 and
+// decimals1 to the finer of the two
+func stableRates(decimals0, decimals1 uint64) (uint64, uint64) {
+	finer := max64(decimals0, decimals1)
+	return pow10(finer - decimals0), pow10(finer - decimals1)
+}
+
+func pow10(n uint64) uint64 {
+	p := uint64(1)
+	for ; n > 0; n-- {
+		p *= 10
+	}
+	return p
+}
+
+// scaled returns amount·rate
+func scaled(amount, rate uint64) *big.Int {
+	v := new(big.Int).SetUint64(amount)
+	return v.Mul(v, new(big.Int).SetUint64(rate))
+}
+
+// bigU64 returns v as a uint64; ok is false when it does not fit
+func bigU64(v *big.Int) (uint64, bool) {
+	if v.Sign() < 0 || v.BitLen() > 64 {
+		return 0, false
+	}
+	return v.Uint64(), true
+}
+
+// stableD returns the invariant D of scaled balances x and y by Newton's
+// method from D = x + y. ok is false when a balance is empty or the
+// iteration does not converge.
+func stableD(x, y *big.Int, amp uint64) (*big.Int, bool) {
+	if x.Sign() <= 0 || y.Sign() <= 0 {
+		return nil, false
+	}
+	s := new(big.Int).Add(x, y)
+	ann := new(big.Int).SetUint64(4 * amp)
+	annMinusOne := new(big.Int).Sub(ann, bigOne)
+	twoX := new(big.Int).Lsh(x, 1)
+	twoY := new(big.Int).Lsh(y, 1)
+
+	d := new(big.Int).Set(s)
+	for i := 0; i < stableMaxNewtonIt; i++ {
+		// dP = D³ / (4xy), divided step by step as Curve does
+		dP := new(big.Int).Mul(d, d)
+		dP.Quo(dP, twoX)
+		dP.Mul(dP, d)
+		dP.Quo(dP, twoY)
+
+		// D' = (Ann·S + 2·dP)·D / ((Ann − 1)·D + 3·dP)
+		num := new(big.Int).Mul(ann, s)
+		num.Add(num, new(big.Int).Lsh(dP, 1))
+		num.Mul(num, d)
+		den := new(big.Int).Mul(annMinusOne, d)
+		den.Add(den, new(big.Int).Mul(bigThree, dP))
+		next := num.Quo(num, den)
+
+		if withinOne(next, d) {
+			return next, true
+		}
+		d = next
+	}
+	return nil, false
+}
+
+// stableY returns the balance y that keeps the invariant at d when the other
+// balance is x, by Newton's method from y = d. ok is false when x is empty or
+// the iteration does not converge.
+func stableY(x, d *big.Int, amp uint64) (*big.Int, bool) {
+	if x.Sign() <= 0 {
+		return nil, false
+	}
+	ann := new(big.Int).SetUint64(4 * amp)
+
+	// y² + (b − D)·y = c with c = D³ / (4·Ann·x) and b = x + D/Ann
+	c := new(big.Int).Mul(d, d)
+	c.Quo(c, new(big.Int).Lsh(x, 1))
+	c.Mul(c, d)
+	c.Quo(c, new(big.Int).Lsh(ann, 1))
+	b := new(big.Int).Quo(d, ann)
+	b.Add(b, x)
+
+	y := new(big.Int).Set(d)
+	for i := 0; i < stableMaxNewtonIt; i++ {
+		// y' = (y² + c) / (2y + b − D)
+		num := new(big.Int).Mul(y, y)
+		num.Add(num, c)
+		den := new(big.Int).Lsh(y, 1)
+		den.Add(den, b)
+		den.Sub(den, d)
+		if den.Sign() <= 0 {
+			return nil, false
+		}
+		next := num.Quo(num, den)
+
+		if withinOne(next, y) {
+			return next, true
+		}
+		y = next
+	}
+	return nil, false
+}
+
+// withinOne reports whether a and b differ by at most one
+func withinOne(a, b *big.Int) bool {
+	diff := new(big.Int).Sub(a, b)
+	return diff.CmpAbs(bigOne) <= 0
+}
+
+// stableSwapOutput returns the StableSwap output for amountIn after the pool
+// fee, rounded down in favour of the pool. ok is false when a reserve is
+// empty, the new input reserve overflows or the invariant does not converge.
+func stableSwapOutput(amountIn, reserveIn, reserveOut uint64, c poolCurve) (uint64, bool) {
+	if reserveIn == 0 || reserveOut == 0 {
+		return 0, false
+	}
+	newReserveIn, ok := addU64(reserveIn, applyFeeBps(amountIn, c.FeeBps))
+	if !ok {
+		return 0, false
+	}
+
+	y := scaled(reserveOut, c.RateOut)
+	d, ok := stableD(scaled(reserveIn, c.RateIn), y, c.Amp)
+	if !ok {
+		return 0, false
+	}
+	newY, ok := stableY(scaled(newReserveIn, c.RateIn), d, c.Amp)
+	if !ok {
+		return 0, false
+	}
+
+	// One scaled unit is held back against rounding in the iterations
+	dy := y.Sub(y, newY)
+	dy.Sub(dy, bigOne)
+	if dy.Sign() <= 0 {
+		return 0, true
+	}
+	// dy is below the scaled reserveOut, so the output is below reserveOut
+	out, _ := bigU64(dy.Quo(dy, new(big.Int).SetUint64(c.RateOut)))
+	return out, true
+}
+
+// stableSpot returns the marginal output per unit of input of a stable pool
+// as a fraction num/den of scaled amounts: −dy/dx of the invariant,
+//
+//	(4·Ann·x²·y² + D³·y) / (4·Ann·x²·y² + D³·x)
+func stableSpot(reserveIn, reserveOut uint64, c poolCurve) (*big.Int, *big.Int, bool) {
+	x, y := scaled(reserveIn, c.RateIn), scaled(reserveOut, c.RateOut)
+	d, ok := stableD(x, y, c.Amp)
+	if !ok {
+		return nil, nil, false
+	}
+	xy := new(big.Int).Mul(x, y)
+	common := new(big.Int).Mul(xy, xy)
+	common.Mul(common, new(big.Int).SetUint64(16*c.Amp))
+	d3 := new(big.Int).Mul(d, d)
+	d3.Mul(d3, d)
+
+	num := new(big.Int).Add(common, new(big.Int).Mul(d3, y))
+	den := new(big.Int).Add(common, new(big.Int).Mul(d3, x))
+	return num, den, true
+}
+
+// stableSpotAmountOut returns amountIn valued at a stable pool's marginal
+// price, saturating at the uint64 range
+func stableSpotAmountOut(amountIn, reserveIn, reserveOut uint64, c poolCurve) uint64 {
+	num, den, ok := stableSpot(reserveIn, reserveOut, c)
+	if !ok {
+		return 0
+	}
+	out := scaled(amountIn, c.RateIn)
+	out.Mul(out, num)
+	out.Quo(out, den.Mul(den, new(big.Int).SetUint64(c.RateOut)))
+	if v, fits := bigU64(out); fits {
+		return v
+	}
+	return ^uint64(0)
+}
+
+// stablePriceX64 returns a stable pool's marginal price of the input asset in
+// units of the output asset as an unsigned 64.64 fixed-point number
+func stablePriceX64(reserveIn, reserveOut uint64, c poolCurve) u128 {
+	num, den, ok := stableSpot(reserveIn, reserveOut, c)
+	if !ok {
+		return u128{}
+	}
+	p := num.Mul(num, new(big.Int).SetUint64(c.RateIn))
+	p.Lsh(p, 64)
+	p.Quo(p, den.Mul(den, new(big.Int).SetUint64(c.RateOut)))
+	if p.BitLen() > 128 {
+		return u128{^uint64(0), ^uint64(0)}
+	}
+	lo := new(big.Int).And(p, new(big.Int).SetUint64(^uint64(0)))
+	return u128{new(big.Int).Rsh(p, 64).Uint64(), lo.Uint64()}
+}
+
+// stableLiquidity returns the LP minted for raising a stable pool's reserves
+// from reserve0/reserve1 to new0/new1, with c oriented asset0 to asset1. The
+// first deposit mints D. Later deposits mint totalLP·(D2 − D0)/D0, where D2
+// is the invariant after an imbalance fee of half the swap fee is charged on
+// how far each side is from a proportional deposit; the fee stays in the
+// pool for LPs. The result is 0 when a new reserve is empty. ok is false when
+// the invariant does not converge or the LP does not fit in 64 bits.
+func stableLiquidity(reserve0, reserve1, new0, new1, totalLP uint64, c poolCurve) (uint64, bool) {
+	if new0 == 0 || new1 == 0 {
+		return 0, true
+	}
+	x1, y1 := scaled(new0, c.RateIn), scaled(new1, c.RateOut)
+	d1, ok := stableD(x1, y1, c.Amp)
+	if !ok {
+		return 0, false
+	}
+	if totalLP == 0 {
+		return bigU64(d1)
+	}
+
+	x0, y0 := scaled(reserve0, c.RateIn), scaled(reserve1, c.RateOut)
+	d0, ok := stableD(x0, y0, c.Amp)
+	if !ok {
+		return 0, false
+	}
+	if d1.Cmp(d0) <= 0 {
+		return 0, true
+	}
+
+	// Fee on the distance from the ideal balances d1·old/d0 at fee/2, the
+	// two-coin n/(4(n − 1)) share of the swap fee Curve charges
+	feeDen := new(big.Int).SetUint64(2 * bpsDenominator)
+	adjusted := [2]*big.Int{x1, y1}
+	for i, old := range [2]*big.Int{x0, y0} {
+		ideal := new(big.Int).Mul(d1, old)
+		ideal.Quo(ideal, d0)
+		diff := ideal.Sub(ideal, adjusted[i])
+		fee := diff.Abs(diff)
+		fee.Mul(fee, new(big.Int).SetUint64(c.FeeBps))
+		fee.Quo(fee, feeDen)
+		adjusted[i] = new(big.Int).Sub(adjusted[i], fee)
+	}
+	d2, ok := stableD(adjusted[0], adjusted[1], c.Amp)
+	if !ok {
+		return 0, false
+	}
+	if d2.Cmp(d0) <= 0 {
+		return 0, true
+	}
+
+	minted := d2.Sub(d2, d0)
+	minted.Mul(minted, new(big.Int).SetUint64(totalLP))
+	minted.Quo(minted, d0)
+	return bigU64(minted)
+}
@@ -14,6 +14,7 @@ type DexInstruction struct {
 	AssetIn     string                 `json:"asset_in"`
 	AssetOut    string                 `json:"asset_out"`
 	Recipient   string                 `json:"recipient"`
+	AmountIn    *int64                 `json:"amount_in,omitempty"`
 	SlippageBps *int                   `json:"slippage_bps,omitempty"`
 	MinAmountOut *int64                `json:"min_amount_out,omitempty"`
 	Beneficiary *string                `json:"beneficiary,omitempty"`
@@ -0,0 +1,33 @@
+// Mock mapping contract for the dex-router integration tests. Its unmap
+// action draws the amount of BTC the caller allowed and records it per
+// destination address instead of sending it to Bitcoin.
+//
+//	tinygo build -o artifacts/mapping.wasm -target wasm ./testdata/mapping
+package main
+
+import (
+	sdk "dex-router/sdk"
+	"encoding/json"
+	"strconv"
+)
+
+func main() {}
+
+// Payload: JSON {"to": "bc1...", "amount": 100000}
+//
+//go:wasmexport unmap
+func Unmap(payload *string) *string {
+	var params struct {
+		To     string `json:"to"`
+		Amount int64  `json:"amount"`
+	}
+	if payload == nil || json.Unmarshal([]byte(*payload), &params) != nil || params.To == "" || params.Amount <= 0 {
+		sdk.Abort("invalid payload")
+	}
+
+	sdk.HiveDraw(params.Amount, sdk.Asset("BTC"))
+	sdk.StateSetObject("unmapped/"+params.To, strconv.FormatInt(params.Amount, 10))
+
+	ret := "ok"
+	return &ret
+}
@@ -2,34 +2,94 @@ package main
 
 import (
 	sdk "dex-router/sdk"
-	"math/bits"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Keys for state storage
 const (
-	keyVersion          = "version"
-	keyNextPoolId       = "next_pool_id"
-	keyPoolPrefix       = "pool/" // pool/{poolId}/...
-	keyPoolAsset0       = "asset0"
-	keyPoolAsset1       = "asset1"
-	keyPoolReserve0     = "reserve0"
-	keyPoolReserve1     = "reserve1"
-	keyPoolFee          = "fee"
-	keyPoolTotalLP      = "total_lp"
-	keyPoolLpPrefix     = "lp/" // lp/{address}
-	keyPoolFee0         = "fee0"
-	keyPoolFee1         = "fee1"
-	keyPoolFeeLastClaim = "fee_last_claim"
+	keyVersion              = "version"
+	keyNextPoolId           = "next_pool_id"
+	keyOwner                = "owner"
+	keyAdminPrefix          = "admin/" // admin/{address} -> "true"
+	keyAssetPrefix          = "asset/" // asset/{symbol}/...
+	keyAssetDecimals        = "decimals"
+	keyAssetEnabled         = "enabled"
+	keyAssetCount           = "asset_count"
+	keyAssetIndexPrefix     = "asset_index/" // asset_index/{n} -> symbol, n from 1
+	keyPoolPrefix           = "pool/"        // pool/{poolId}/...
+	keyPoolAsset0           = "asset0"
+	keyPoolAsset1           = "asset1"
+	keyPoolReserve0         = "reserve0"
+	keyPoolReserve1         = "reserve1"
+	keyPoolFee              = "fee"
+	keyPoolType             = "type" // absent for constant-product pools created before pool types
+	keyPoolAmp              = "amp"
+	keyPoolTotalLP          = "total_lp"
+	keyPoolLpPrefix         = "lp/"        // lp/{address}
+	keyPoolAllowance        = "allowance/" // allowance/{owner}/{spender}
+	keyPoolFee0             = "fee0"
+	keyPoolFee1             = "fee1"
+	keyPoolFeeLastClaim     = "fee_last_claim"
+	keyPoolPaused           = "paused"
+	keyPoolPrice0Cumulative = "price0_cumulative" // see oracle.go
+	keyPoolPrice1Cumulative = "price1_cumulative"
+	keyPoolPriceBlock       = "price_block"
+	keyPoolObsPrefix        = "obs/" // obs/{slot}
+	keyPoolObsCount         = "obs_count"
+	keyPoolProtocolFee      = "protocol_share" // bps of the swap fee kept for the protocol
+	keyPoolSlipBaseline     = "slip_baseline"  // price impact bps above which the slippage surcharge applies
+	keyPoolSlipShare        = "slip_share"     // bps of the slippage surcharge kept for the protocol
+	keyPairPrefix           = "pair/"          // pair/{assetA}/{assetB}/{feeBps} -> poolId
+	keyPairTiers            = "tiers"          // pair/{assetA}/{assetB}/tiers -> sorted fee tiers, comma separated
+	keyMappingPrefix        = "mapping/"       // mapping/{chain} -> mapping contract id, see refund.go
+	keyTreasury             = "treasury"       // claimed protocol fees go here, see fees.go
+	keyFeeClaimInterval     = "fee_claim_interval"
 )
 
 const (
 	defaultBaseFeeBps        = 8     // 0.08%
 	defaultFeeClaimIntervalS = 86400 // 1 day
-	defaultSlipBaselineBps   = 0     // off by default
-	defaultSlipShareBps      = 0     // off by default
+	defaultProtocolShareBps  = 10000 // whole swap fee accrues to the protocol
+	defaultSlipBaselineBps   = 0     // slippage surcharge off by default
+	defaultSlipShareBps      = 0     // whole surcharge stays with LPs
+	maxSwapHops              = 4     // pools a single swap may route through
+	defaultPageLimit         = 50    // entries per page of list queries
+	maxPageLimit             = 100
+	maxAssetDecimals         = 18
 )
 
+// Ledger assets registered at init
+var defaultAssets = []struct {
+	Symbol   string
+	Decimals uint64
+}{
+	{"HBD", 3},
+	{"HIVE", 3},
+}
+
+// LP locked forever on a pool's first deposit, so the share price cannot be
+// inflated by donating to a pool with a dust supply
+const (
+	minimumLiquidity = 1000
+	burnAddress      = "system:burn"
+)
+
+// Layouts accepted for block and deadline timestamps; Hive block times carry
+// no zone and are UTC
+var timestampLayouts = []string{time.RFC3339, "2006-01-02T15:04:05"}
+
+// parseTimestamp parses an RFC 3339 or Hive block timestamp
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
 // Pool key helpers
 func poolKey(poolId string, suffix string) string {
 	return keyPoolPrefix + poolId + "/" + suffix
@@ -63,6 +123,10 @@ func poolLpKey(poolId, address string) string {
 	return poolKey(poolId, keyPoolLpPrefix+address)
 }
 
+func poolAllowanceKey(poolId, owner, spender string) string {
+	return poolKey(poolId, keyPoolAllowance+owner+"/"+spender)
+}
+
 func poolFee0Key(poolId string) string {
 	return poolKey(poolId, keyPoolFee0)
 }
@@ -75,6 +139,61 @@ func poolFeeLastClaimKey(poolId string) string {
 	return poolKey(poolId, keyPoolFeeLastClaim)
 }
 
+func poolTypeKey(poolId string) string {
+	return poolKey(poolId, keyPoolType)
+}
+
+func poolAmpKey(poolId string) string {
+	return poolKey(poolId, keyPoolAmp)
+}
+
+func poolProtocolShareKey(poolId string) string {
+	return poolKey(poolId, keyPoolProtocolFee)
+}
+
+func poolSlipBaselineKey(poolId string) string {
+	return poolKey(poolId, keyPoolSlipBaseline)
+}
+
+func poolSlipShareKey(poolId string) string {
+	return poolKey(poolId, keyPoolSlipShare)
+}
+
+func poolPausedKey(poolId string) string {
+	return poolKey(poolId, keyPoolPaused)
+}
+
+func adminKey(address string) string {
+	return keyAdminPrefix + address
+}
+
+// Asset registry key helpers
+func assetKey(symbol, suffix string) string {
+	return keyAssetPrefix + symbol + "/" + suffix
+}
+
+func assetIndexKey(n uint64) string {
+	return keyAssetIndexPrefix + strconv.FormatUint(n, 10)
+}
+
+// pairPrefix returns the canonical index prefix for an asset pair; the
+// assets are ordered so both swap directions resolve to the same keys
+func pairPrefix(assetA, assetB string) string {
+	if assetB < assetA {
+		assetA, assetB = assetB, assetA
+	}
+	return keyPairPrefix + assetA + "/" + assetB + "/"
+}
+
+// pairKey returns the index key of a pair's pool at one fee tier
+func pairKey(assetA, assetB string, feeBps uint64) string {
+	return pairPrefix(assetA, assetB) + strconv.FormatUint(feeBps, 10)
+}
+
+func pairTiersKey(assetA, assetB string) string {
+	return pairPrefix(assetA, assetB) + keyPairTiers
+}
+
 // State helpers
 func getStr(key string) string {
 	v := sdk.StateGetObject(key)
@@ -135,6 +254,61 @@ func getPoolFee(poolId string) uint64 {
 	return getUint(poolFeeKey(poolId))
 }
 
+// getPoolProtocolShare returns the protocol's share of the swap fee in bps;
+// pools created before the split was configurable use the default
+func getPoolProtocolShare(poolId string) uint64 {
+	if getStr(poolProtocolShareKey(poolId)) == "" {
+		return defaultProtocolShareBps
+	}
+	return getUint(poolProtocolShareKey(poolId))
+}
+
+// getPoolSlipParams returns the pool's slippage surcharge baseline and
+// protocol share, in basis points
+func getPoolSlipParams(poolId string) (baselineBps, shareBps uint64) {
+	baselineBps, shareBps = defaultSlipBaselineBps, defaultSlipShareBps
+	if getStr(poolSlipBaselineKey(poolId)) != "" {
+		baselineBps = getUint(poolSlipBaselineKey(poolId))
+	}
+	if getStr(poolSlipShareKey(poolId)) != "" {
+		shareBps = getUint(poolSlipShareKey(poolId))
+	}
+	return baselineBps, shareBps
+}
+
+// getPoolType returns the pool's invariant; pools created before pool types
+// are constant product
+func getPoolType(poolId string) string {
+	if poolType := getStr(poolTypeKey(poolId)); poolType != "" {
+		return poolType
+	}
+	return poolTypeConstantProduct
+}
+
+func getPoolAmp(poolId string) uint64 {
+	return getUint(poolAmpKey(poolId))
+}
+
+// getPoolCurve returns the swap parameters of a pool for swaps from asset0
+// when inputIsAsset0 is set, and from asset1 otherwise
+func getPoolCurve(poolId string, inputIsAsset0 bool) poolCurve {
+	curve := poolCurve{
+		Type:             getPoolType(poolId),
+		FeeBps:           getPoolFee(poolId),
+		ProtocolShareBps: getPoolProtocolShare(poolId),
+	}
+	curve.SlipBaselineBps, curve.SlipShareBps = getPoolSlipParams(poolId)
+	if curve.Type == poolTypeStableSwap {
+		curve.Amp = getPoolAmp(poolId)
+		curve.RateIn, curve.RateOut = stableRates(
+			getAssetDecimals(getPoolAsset0(poolId)), getAssetDecimals(getPoolAsset1(poolId)))
+		if !inputIsAsset0 {
+			curve.RateIn, curve.RateOut = curve.RateOut, curve.RateIn
+		}
+	}
+	return curve
+}
+
 func getPoolTotalLp(poolId string) uint64 {
 	return getUint(poolTotalLpKey(poolId))
 }
@@ -143,6 +317,14 @@ func getPoolLp(poolId, address string) uint64 {
 	return getUint(poolLpKey(poolId, address))
 }
 
+func getPoolAllowance(poolId, owner, spender string) uint64 {
+	return getUint(poolAllowanceKey(poolId, owner, spender))
+}
+
+func isPoolPaused(poolId string) bool {
+	return getStr(poolPausedKey(poolId)) == "true"
+}
+
 func setPoolAsset0(poolId, asset string) {
 	setStr(poolAsset0Key(poolId), asset)
 }
@@ -163,6 +345,31 @@ func setPoolFee(poolId string, fee uint64) {
 	setUint(poolFeeKey(poolId), fee)
 }
 
+func setPoolType(poolId, poolType string) {
+	setStr(poolTypeKey(poolId), poolType)
+}
+
+func setPoolAmp(poolId string, amp uint64) {
+	setUint(poolAmpKey(poolId), amp)
+}
+
+func setPoolProtocolShare(poolId string, shareBps uint64) {
+	setUint(poolProtocolShareKey(poolId), shareBps)
+}
+
+func setPoolSlipParams(poolId string, baselineBps, shareBps uint64) {
+	setUint(poolSlipBaselineKey(poolId), baselineBps)
+	setUint(poolSlipShareKey(poolId), shareBps)
+}
+
+// setPoolReserves writes both reserves of a pool, first advancing its price
+// accumulators with the reserves being replaced
+func setPoolReserves(poolId string, reserve0, reserve1 uint64) {
+	updatePriceAccumulators(poolId)
+	setPoolReserve0(poolId, reserve0)
+	setPoolReserve1(poolId, reserve1)
+}
+
 func setPoolTotalLp(poolId string, totalLp uint64) {
 	setUint(poolTotalLpKey(poolId), totalLp)
 }
@@ -171,6 +378,144 @@ func setPoolLp(poolId, address string, amount uint64) {
 	setUint(poolLpKey(poolId, address), amount)
 }
 
+func setPoolAllowance(poolId, owner, spender string, amount uint64) {
+	setUint(poolAllowanceKey(poolId, owner, spender), amount)
+}
+
+func setPoolPaused(poolId string, paused bool) {
+	if paused {
+		setStr(poolPausedKey(poolId), "true")
+	} else {
+		sdk.StateDeleteObject(poolPausedKey(poolId))
+	}
+}
+
+// Pair index helpers
+func getPairPool(assetA, assetB string, feeBps uint64) string {
+	return getStr(pairKey(assetA, assetB, feeBps))
+}
+
+// getPairTiers returns the fee tiers a pair has pools at, lowest first
+func getPairTiers(assetA, assetB string) []uint64 {
+	raw := getStr(pairTiersKey(assetA, assetB))
+	if raw == "" {
+		return nil
+	}
+	parts := strings.Split(raw, ",")
+	tiers := make([]uint64, 0, len(parts))
+	for _, part := range parts {
+		fee, err := strconv.ParseUint(part, 10, 64)
+		if err == nil {
+			tiers = append(tiers, fee)
+		}
+	}
+	return tiers
+}
+
+func setPairTiers(assetA, assetB string, tiers []uint64) {
+	parts := make([]string, len(tiers))
+	for i, fee := range tiers {
+		parts[i] = strconv.FormatUint(fee, 10)
+	}
+	setStr(pairTiersKey(assetA, assetB), strings.Join(parts, ","))
+}
+
+// getPairPools returns a pair's pools ordered by fee tier, lowest first
+func getPairPools(assetA, assetB string) []string {
+	tiers := getPairTiers(assetA, assetB)
+	pools := make([]string, 0, len(tiers))
+	for _, fee := range tiers {
+		pools = append(pools, getPairPool(assetA, assetB, fee))
+	}
+	return pools
+}
+
+// setPairPool indexes a pool under its pair and fee tier
+func setPairPool(assetA, assetB string, feeBps uint64, poolId string) {
+	setStr(pairKey(assetA, assetB, feeBps), poolId)
+
+	tiers := getPairTiers(assetA, assetB)
+	i := 0
+	for i < len(tiers) && tiers[i] < feeBps {
+		i++
+	}
+	if i < len(tiers) && tiers[i] == feeBps {
+		return
+	}
+	tiers = append(tiers[:i], append([]uint64{feeBps}, tiers[i:]...)...)
+	setPairTiers(assetA, assetB, tiers)
+}
+
+// removePairPool drops a pair's fee tier from the index
+func removePairPool(assetA, assetB string, feeBps uint64) {
+	sdk.StateDeleteObject(pairKey(assetA, assetB, feeBps))
+
+	tiers := getPairTiers(assetA, assetB)
+	kept := tiers[:0]
+	for _, fee := range tiers {
+		if fee != feeBps {
+			kept = append(kept, fee)
+		}
+	}
+	setPairTiers(assetA, assetB, kept)
+}
+
+// Asset registry helpers
+func isAssetRegistered(symbol string) bool {
+	return getStr(assetKey(symbol, keyAssetDecimals)) != ""
+}
+
+func getAssetDecimals(symbol string) uint64 {
+	return getUint(assetKey(symbol, keyAssetDecimals))
+}
+
+func isAssetEnabled(symbol string) bool {
+	return getStr(assetKey(symbol, keyAssetEnabled)) == "true"
+}
+
+func setAssetEnabled(symbol string, enabled bool) {
+	setStr(assetKey(symbol, keyAssetEnabled), strconv.FormatBool(enabled))
+}
+
+// registerAsset adds a new asset to the registry and its listing index
+func registerAsset(symbol string, decimals uint64, enabled bool) {
+	setUint(assetKey(symbol, keyAssetDecimals), decimals)
+	setAssetEnabled(symbol, enabled)
+	count := getUint(keyAssetCount) + 1
+	setUint(keyAssetCount, count)
+	setStr(assetIndexKey(count), symbol)
+}
+
+// assetInfo returns the public view of a registered asset
+func assetInfo(symbol string) map[string]interface{} {
+	return map[string]interface{}{
+		"symbol":   symbol,
+		"decimals": getAssetDecimals(symbol),
+		"enabled":  isAssetEnabled(symbol),
+	}
+}
+
+// checkAsset rejects assets missing from the registry, and disabled ones
+// unless allowDisabled is set
+func checkAsset(symbol string, allowDisabled bool) *string {
+	if !isAssetRegistered(symbol) {
+		return fail(errCodeUnknownAsset, "unknown asset "+symbol)
+	}
+	if !allowDisabled && !isAssetEnabled(symbol) {
+		return fail(errCodeAssetDisabled, "asset "+symbol+" disabled")
+	}
+	return nil
+}
+
+// poolCount returns the number of pools created; pool IDs run from 1 to it
+func poolCount() uint64 {
+	next := getUint(keyNextPoolId)
+	if next == 0 {
+		return 0
+	}
+	return next - 1
+}
+
 // Utility functions
 func min64(a, b uint64) uint64 {
 	if a < b {
@@ -186,12 +531,6 @@ func max64(a, b uint64) uint64 {
 	return b
 }
 
-func assertCustom(cond bool) {
-	if !cond {
-		panic("assertion failed")
-	}
-}
-
 func isSystemSender() bool {
 	env := sdk.GetEnv()
 	if env.Sender.Address.Domain() == sdk.AddressDomainSystem {
@@ -203,33 +542,160 @@ func isSystemSender() bool {
 	return false
 }
 
-// Token adapter wrappers
-func drawAsset(amount int64, asset string) {
-	sdk.HiveDraw(amount, sdk.Asset(asset))
+// isInitialized reports whether init has run. Deployments initialized
+// before the contract had an owner only have a version and pool counter.
+func isInitialized() bool {
+	return getStr(keyOwner) != "" || getStr(keyVersion) != "" || getStr(keyNextPoolId) != ""
 }
 
-func transferAsset(to string, amount int64, asset string) {
-	sdk.HiveTransfer(sdk.Address(to), amount, sdk.Asset(asset))
+// deploymentOwner returns the account that deployed the contract
+func deploymentOwner() string {
+	if owner := sdk.GetEnvKey("contract.owner"); owner != nil {
+		return *owner
+	}
+	return ""
+}
+
+// hasRequiredAuth reports whether address signed the transaction with its
+// active authority
+func hasRequiredAuth(address string) bool {
+	for _, auth := range sdk.GetEnv().Sender.RequiredAuths {
+		if auth.String() == address {
+			return true
+		}
+	}
+	return false
+}
+
+// isOwner reports whether the contract owner signed the transaction
+func isOwner() bool {
+	owner := getStr(keyOwner)
+	return owner != "" && hasRequiredAuth(owner)
 }
 
-// Check if asset is HBD
-func isHbd(asset string) bool {
-	return asset == "HBD"
+// isAdmin reports whether the owner or an admin signed the transaction
+func isAdmin() bool {
+	if isOwner() {
+		return true
+	}
+	for _, auth := range sdk.GetEnv().Sender.RequiredAuths {
+		if getStr(adminKey(auth.String())) == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// callerAddress returns the account acting on the contract: a calling
+// contract acts as itself, otherwise the transaction sender
+func callerAddress() string {
+	env := sdk.GetEnv()
+	if env.Caller.Domain() == sdk.AddressDomainContract {
+		return env.Caller.String()
+	}
+	return env.Sender.Address.String()
 }
 
-// sqrt128 returns floor(sqrt(hi:lo)) where hi:lo is a 128-bit unsigned integer
-func sqrt128(hi, lo uint64) uint64 {
-	var low, high uint64 = 0, ^uint64(0) >> 1
-	var ans uint64
-	for low <= high {
-		mid := (low + high) >> 1
-		mh, ml := bits.Mul64(mid, mid)
-		if mh < hi || (mh == hi && ml <= lo) {
-			ans = mid
-			low = mid + 1
-		} else {
-			high = mid - 1
+// actsFor reports whether the account acting on the contract may act for
+// address: a calling contract only for itself, otherwise the transaction
+// sender or any of its active signers
+func actsFor(address string) bool {
+	env := sdk.GetEnv()
+	if env.Caller.Domain() == sdk.AddressDomainContract {
+		return env.Caller.String() == address
+	}
+	return env.Sender.Address.String() == address || hasRequiredAuth(address)
+}
+
+// Transfer intents
+//
+// A caller lets the contract draw its funds with transfer.allow intents,
+// {"type": "transfer.allow", "args": {"token": "HBD", "limit": "1.000"}}.
+// The host ledger reads every limit as a base-unit amount written with
+// exactly three decimal places, whatever the asset's registered decimals
+// ("100.000" BTC allows 100000 satoshis), and only fails the call from inside
+// sdk.HiveDraw. The contract checks each draw against the limit in that
+// format before any state is written, counting the first intent for a token.
+const (
+	intentTransferAllow = "transfer.allow"
+	intentLimitDecimals = 3
+)
+
+// intentLimit returns the transfer.allow limit for asset in base units.
+// found is false when no intent names the asset, ok false when its limit is
+// malformed.
+func intentLimit(intents []sdk.Intent, asset string) (limit uint64, found, ok bool) {
+	for _, intent := range intents {
+		if intent.Type != intentTransferAllow || intent.Args["token"] != asset {
+			continue
 		}
+		raw, hasLimit := intent.Args["limit"]
+		if !hasLimit {
+			continue
+		}
+		limit, ok = parseIntentLimit(raw)
+		return limit, true, ok
+	}
+	return 0, false, false
+}
+
+// parseIntentLimit reads a limit such as "1.000" as 1000 base units
+func parseIntentLimit(raw string) (uint64, bool) {
+	whole, frac, hasDot := strings.Cut(raw, ".")
+	if !hasDot || whole == "" || len(frac) != intentLimitDecimals {
+		return 0, false
+	}
+	limit, err := strconv.ParseUint(whole+frac, 10, 63)
+	if err != nil {
+		return 0, false
 	}
-	return ans
+	return limit, true
+}
+
+// formatIntentLimit writes amount base units as a limit such as "1.000"
+func formatIntentLimit(amount uint64) string {
+	digits := strconv.FormatUint(amount, 10)
+	if pad := intentLimitDecimals + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	split := len(digits) - intentLimitDecimals
+	return digits[:split] + "." + digits[split:]
+}
+
+// transferAllowIntent lets a called contract draw up to amount of asset
+func transferAllowIntent(asset string, amount uint64) sdk.Intent {
+	return sdk.Intent{
+		Type: intentTransferAllow,
+		Args: map[string]string{"token": asset, "limit": formatIntentLimit(amount)},
+	}
+}
+
+// checkDraw rejects drawing amount of asset beyond the caller's transfer.allow
+// intent. Each call draws an asset at most once, so the whole limit is
+// available.
+func checkDraw(asset string, amount uint64) *string {
+	if amount == 0 {
+		return nil
+	}
+	limit, found, ok := intentLimit(sdk.GetEnv().Intents, asset)
+	if !found {
+		return fail(errCodeIntentMissing, "no transfer.allow intent for "+asset)
+	}
+	if !ok {
+		return fail(errCodeIntentInvalid, "invalid transfer.allow limit for "+asset)
+	}
+	if amount > limit {
+		return fail(errCodeIntentExceeded, asset+" amount "+strconv.FormatUint(amount, 10)+
+			" exceeds transfer.allow limit "+strconv.FormatUint(limit, 10))
+	}
+	return nil
+}
+
+// Token adapter wrappers
+func drawAsset(amount int64, asset string) {
+	sdk.HiveDraw(amount, sdk.Asset(asset))
+}
+
+func transferAsset(to string, amount int64, asset string) {
+	sdk.HiveTransfer(sdk.Address(to), amount, sdk.Asset(asset))
 }
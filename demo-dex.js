@@ -71,8 +71,8 @@ class DexDemo {
                 asset_out: 'HIVE',
                 recipient: 'alice',
                 metadata: {
-                    amount0: '1000000', // 1000 HBD
-                    amount1: '500000'    // 500 HIVE
+                    amount0: 1000000, // 1000 HBD
+                    amount1: 500000    // 500 HIVE
                 }
             });
             console.log('✅ Liquidity added to HIVE-HBD pool:', liquidity1);
@@ -85,8 +85,8 @@ class DexDemo {
                 asset_out: 'BTC',
                 recipient: 'alice',
                 metadata: {
-                    amount0: '2000000', // 2000 HBD
-                    amount1: '100000'    // 1 BTC (100000 sats)
+                    amount0: 2000000, // 2000 HBD
+                    amount1: 100000    // 1 BTC (100000 sats)
                 }
             });
             console.log('✅ Liquidity added to BTC-HBD pool:', liquidity2);
@@ -201,7 +201,7 @@ class DexDemo {
                 asset_out: 'HIVE',
                 recipient: 'alice',
                 metadata: {
-                    lp_amount: '353553'  // ~50% of LP tokens
+                    lp_amount: 353553  // ~50% of LP tokens
                 }
             });
             console.log('✅ Partial withdrawal completed:', withdrawal);
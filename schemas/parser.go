@@ -39,6 +39,12 @@ func ParseFromQueryParams(query string) (*SwapInstruction, error) {
 	instruction.Recipient = values.Get("recipient")
 
 	// Parse optional fields
+	if amountInStr := values.Get("amount_in"); amountInStr != "" {
+		if amountIn, err := strconv.ParseInt(amountInStr, 10, 64); err == nil {
+			instruction.AmountIn = &amountIn
+		}
+	}
+
 	if slippageStr := values.Get("slippage_bps"); slippageStr != "" {
 		if slippage, err := strconv.Atoi(slippageStr); err == nil {
 			instruction.SlippageBps = &slippage
@@ -51,6 +57,16 @@ func ParseFromQueryParams(query string) (*SwapInstruction, error) {
 		}
 	}
 
+	if pathStr := values.Get("path"); pathStr != "" {
+		instruction.Path = strings.Split(pathStr, ",")
+	}
+
+	if feeBpsStr := values.Get("fee_bps"); feeBpsStr != "" {
+		if feeBps, err := strconv.Atoi(feeBpsStr); err == nil {
+			instruction.FeeBps = &feeBps
+		}
+	}
+
 	if beneficiary := values.Get("beneficiary"); beneficiary != "" {
 		instruction.Beneficiary = &beneficiary
 	}
@@ -70,6 +86,19 @@ func ParseFromQueryParams(query string) (*SwapInstruction, error) {
 		}
 	}
 
+	var deadline Deadline
+	if heightStr := values.Get("deadline.block_height"); heightStr != "" {
+		if height, err := strconv.ParseUint(heightStr, 10, 64); err == nil {
+			deadline.BlockHeight = &height
+		}
+	}
+	if timestamp := values.Get("deadline.timestamp"); timestamp != "" {
+		deadline.Timestamp = &timestamp
+	}
+	if deadline.BlockHeight != nil || deadline.Timestamp != nil {
+		instruction.Deadline = &deadline
+	}
+
 	// Parse metadata (if present as JSON string)
 	if metadataStr := values.Get("metadata"); metadataStr != "" {
 		var metadata map[string]interface{}
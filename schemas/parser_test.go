@@ -40,6 +40,9 @@ func TestParseFromJSON(t *testing.T) {
 				"asset_in": "BTC",
 				"asset_out": "HBD_SAVINGS",
 				"recipient": "alice",
+				"amount_in": 100000,
+				"path": ["BTC", "HIVE", "HBD_SAVINGS"],
+				"fee_bps": 30,
 				"slippage_bps": 200,
 				"min_amount_out": 50000,
 				"beneficiary": "referrer",
@@ -54,8 +57,11 @@ func TestParseFromJSON(t *testing.T) {
 				AssetIn:         "BTC",
 				AssetOut:        "HBD_SAVINGS",
 				Recipient:       "alice",
+				AmountIn:        int64Ptr(100000),
 				SlippageBps:     intPtr(200),
 				MinAmountOut:    int64Ptr(50000),
+				Path:            []string{"BTC", "HIVE", "HBD_SAVINGS"},
+				FeeBps:          intPtr(30),
 				Beneficiary:     stringPtr("referrer"),
 				RefBps:          intPtr(500),
 				ReturnAddr:      &ReturnAddress{Chain: "ETH", Address: "0x123..."},
@@ -95,8 +101,11 @@ func TestParseFromJSON(t *testing.T) {
 			assert.Equal(t, tt.expected.AssetIn, result.AssetIn)
 			assert.Equal(t, tt.expected.AssetOut, result.AssetOut)
 			assert.Equal(t, tt.expected.Recipient, result.Recipient)
+			assert.Equal(t, tt.expected.AmountIn, result.AmountIn)
 			assert.Equal(t, tt.expected.SlippageBps, result.SlippageBps)
 			assert.Equal(t, tt.expected.MinAmountOut, result.MinAmountOut)
+			assert.Equal(t, tt.expected.Path, result.Path)
+			assert.Equal(t, tt.expected.FeeBps, result.FeeBps)
 			assert.Equal(t, tt.expected.Beneficiary, result.Beneficiary)
 			assert.Equal(t, tt.expected.RefBps, result.RefBps)
 			assert.Equal(t, tt.expected.ReturnAddr, result.ReturnAddr)
@@ -126,7 +135,7 @@ func TestParseFromQueryParams(t *testing.T) {
 		},
 		{
 			name:  "query with optional fields",
-			query: "type=swap&version=1.0.0&asset_in=BTC&asset_out=HBD&recipient=alice&slippage_bps=200&min_amount_out=50000&beneficiary=referrer&ref_bps=500&return_address.chain=ETH&return_address.address=0x123",
+			query: "type=swap&version=1.0.0&asset_in=BTC&asset_out=HBD&recipient=alice&amount_in=100000&path=BTC,HIVE,HBD&fee_bps=30&slippage_bps=200&min_amount_out=50000&beneficiary=referrer&ref_bps=500&return_address.chain=ETH&return_address.address=0x123",
 			expectError: false,
 			expected: &SwapInstruction{
 				InstructionType: "swap",
@@ -134,13 +143,29 @@ func TestParseFromQueryParams(t *testing.T) {
 				AssetIn:         "BTC",
 				AssetOut:        "HBD",
 				Recipient:       "alice",
+				AmountIn:        int64Ptr(100000),
 				SlippageBps:     intPtr(200),
 				MinAmountOut:    int64Ptr(50000),
+				Path:            []string{"BTC", "HIVE", "HBD"},
+				FeeBps:          intPtr(30),
 				Beneficiary:     stringPtr("referrer"),
 				RefBps:          intPtr(500),
 				ReturnAddr:      &ReturnAddress{Chain: "ETH", Address: "0x123"},
 			},
 		},
+		{
+			name:        "query with deadline",
+			query:       "type=swap&version=1.0.0&asset_in=BTC&asset_out=HBD&recipient=alice&deadline.block_height=1200&deadline.timestamp=2025-01-01T00:10:00Z",
+			expectError: false,
+			expected: &SwapInstruction{
+				InstructionType: "swap",
+				SchemaVersion:   "1.0.0",
+				AssetIn:         "BTC",
+				AssetOut:        "HBD",
+				Recipient:       "alice",
+				Deadline:        &Deadline{BlockHeight: uint64Ptr(1200), Timestamp: stringPtr("2025-01-01T00:10:00Z")},
+			},
+		},
 		{
 			name:        "missing required field",
 			query:       "type=swap&asset_in=BTC&asset_out=HBD&recipient=alice",
@@ -169,6 +194,10 @@ func TestParseFromQueryParams(t *testing.T) {
 			assert.Equal(t, tt.expected.AssetIn, result.AssetIn)
 			assert.Equal(t, tt.expected.AssetOut, result.AssetOut)
 			assert.Equal(t, tt.expected.Recipient, result.Recipient)
+			assert.Equal(t, tt.expected.AmountIn, result.AmountIn)
+			assert.Equal(t, tt.expected.Path, result.Path)
+			assert.Equal(t, tt.expected.FeeBps, result.FeeBps)
+			assert.Equal(t, tt.expected.Deadline, result.Deadline)
 		})
 	}
 }
@@ -247,6 +276,10 @@ func int64Ptr(i int64) *int64 {
 	return &i
 }
 
+func uint64Ptr(i uint64) *uint64 {
+	return &i
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
@@ -290,6 +323,90 @@ func TestValidateInstruction(t *testing.T) {
 			}`,
 			expectError: true,
 		},
+		{
+			name: "invalid amount_in",
+			jsonData: `{
+				"type": "swap",
+				"version": "1.0.0",
+				"asset_in": "BTC",
+				"asset_out": "HBD",
+				"recipient": "alice",
+				"amount_in": 0
+			}`,
+			expectError: true,
+		},
+		{
+			name: "valid deadline",
+			jsonData: `{
+				"type": "swap",
+				"version": "1.0.0",
+				"asset_in": "BTC",
+				"asset_out": "HBD",
+				"recipient": "alice",
+				"deadline": {"block_height": 1200, "timestamp": "2025-01-01T00:10:00Z"}
+			}`,
+			expectError: false,
+		},
+		{
+			name: "block time deadline",
+			jsonData: `{
+				"type": "swap",
+				"version": "1.0.0",
+				"asset_in": "BTC",
+				"asset_out": "HBD",
+				"recipient": "alice",
+				"deadline": {"timestamp": "2025-01-01T00:10:00"}
+			}`,
+			expectError: false,
+		},
+		{
+			name: "date-only deadline",
+			jsonData: `{
+				"type": "swap",
+				"version": "1.0.0",
+				"asset_in": "BTC",
+				"asset_out": "HBD",
+				"recipient": "alice",
+				"deadline": {"timestamp": "2025-01-01"}
+			}`,
+			expectError: true,
+		},
+		{
+			name: "nonexistent deadline date",
+			jsonData: `{
+				"type": "swap",
+				"version": "1.0.0",
+				"asset_in": "BTC",
+				"asset_out": "HBD",
+				"recipient": "alice",
+				"deadline": {"timestamp": "2025-02-30T00:10:00Z"}
+			}`,
+			expectError: true,
+		},
+		{
+			name: "empty deadline",
+			jsonData: `{
+				"type": "swap",
+				"version": "1.0.0",
+				"asset_in": "BTC",
+				"asset_out": "HBD",
+				"recipient": "alice",
+				"deadline": {}
+			}`,
+			expectError: true,
+		},
+		{
+			name: "zero fee tier",
+			jsonData: `{
+				"type": "swap",
+				"version": "1.0.0",
+				"asset_in": "BTC",
+				"asset_out": "HBD",
+				"recipient": "alice",
+				"fee_bps": 0
+			}`,
+			expectError: true,
+		},
 		{
 			name: "invalid type",
 			jsonData: `{
@@ -15,6 +15,14 @@ type ReturnAddress struct {
 	Address string `json:"address"`
 }
 
+// Deadline bounds when an instruction may still execute: at or before a
+// block height, a block timestamp (RFC 3339, or a zone-less UTC block time),
+// or both
+type Deadline struct {
+	BlockHeight *uint64 `json:"block_height,omitempty"`
+	Timestamp   *string `json:"timestamp,omitempty"`
+}
+
 // SwapInstruction represents a swap instruction with snake_case JSON tags
 type SwapInstruction struct {
 	InstructionType string                 `json:"type"`
@@ -22,11 +30,15 @@ type SwapInstruction struct {
 	AssetIn         string                 `json:"asset_in"`
 	AssetOut        string                 `json:"asset_out"`
 	Recipient       string                 `json:"recipient"`
+	AmountIn        *int64                 `json:"amount_in,omitempty"`
 	SlippageBps     *int                   `json:"slippage_bps,omitempty"`
 	MinAmountOut    *int64                 `json:"min_amount_out,omitempty"`
+	Path            []string               `json:"path,omitempty"`
+	FeeBps          *int                   `json:"fee_bps,omitempty"`
 	Beneficiary     *string                `json:"beneficiary,omitempty"`
 	RefBps          *int                   `json:"ref_bps,omitempty"`
 	ReturnAddr      *ReturnAddress         `json:"return_address,omitempty"`
+	Deadline        *Deadline              `json:"deadline,omitempty"`
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -2,7 +2,9 @@ package schemas
 
 import (
 	_ "embed"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/xeipuuv/gojsonschema"
 )
@@ -12,6 +14,10 @@ var schemaBytes []byte
 
 var schemaValidator *gojsonschema.Schema
 
+// Layouts the dex-router contract reads deadline.timestamp with: RFC 3339,
+// or a Hive block time without a zone, which is UTC
+var deadlineTimestampLayouts = []string{time.RFC3339, "2006-01-02T15:04:05"}
+
 func init() {
 	loader := gojsonschema.NewBytesLoader(schemaBytes)
 	var err error
@@ -40,7 +46,30 @@ func ValidateInstruction(data []byte) error {
 		return fmt.Errorf("schema validation failed: %s", errorMsg)
 	}
 
-	return nil
+	return validateDeadlineTimestamp(data)
+}
+
+// validateDeadlineTimestamp rejects a deadline.timestamp the contract cannot
+// parse, such as a date that does not exist, which the schema's pattern lets
+// through
+func validateDeadlineTimestamp(data []byte) error {
+	var instruction struct {
+		Deadline *Deadline `json:"deadline"`
+	}
+	if err := json.Unmarshal(data, &instruction); err != nil {
+		return fmt.Errorf("schema validation error: %w", err)
+	}
+	if instruction.Deadline == nil || instruction.Deadline.Timestamp == nil {
+		return nil
+	}
+
+	timestamp := *instruction.Deadline.Timestamp
+	for _, layout := range deadlineTimestampLayouts {
+		if _, err := time.Parse(layout, timestamp); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("schema validation failed: deadline.timestamp %q is not an RFC 3339 or UTC block timestamp", timestamp)
 }
 
 // ValidateInstructionStruct validates a SwapInstruction struct against the schema
@@ -41,6 +41,8 @@ type PoolInfo struct {
 	Reserve1    uint64  `json:"reserve1"`
 	Fee         float64 `json:"fee"`
 	TotalSupply uint64  `json:"total_supply"`
+	Type        string  `json:"type,omitempty"` // constant_product or stableswap
+	Amp         uint64  `json:"amp,omitempty"`  // stableswap amplification coefficient
 }
 
 
@@ -260,6 +262,16 @@ func (s *Service) pollContractOutputs(ctx context.Context, contractID string, fr
 	// Process contract outputs and extract events
 	for _, output := range result.Data.FindContractOutput {
 		if int64(fromBlock) < output.BlockHeight {
+			// dex-router calls return their versioned event list as the result
+			if len(output.Results) > 0 {
+				if events, ok := parseDexRouterEvents(output.Results[0].Ret, uint64(output.BlockHeight), output.ID); ok {
+					for _, event := range events {
+						s.handleEvent(event)
+					}
+					continue
+				}
+			}
+
 			// This is a new output, process it
 			// Contract outputs contain the result of contract calls, which we can parse as events
 			// The actual event parsing depends on the contract's event structure
@@ -483,6 +495,44 @@ func parseVSCEvent(eventMap map[string]interface{}) *VSCEvent {
 	return event
 }
 
+// dexEventEnvelope is the versioned event list returned by dex-router calls
+type dexEventEnvelope struct {
+	V      int               `json:"v"`
+	Events []json.RawMessage `json:"events"`
+}
+
+// parseDexRouterEvents decodes the event envelope returned by a dex-router
+// call into one event per contract event, with the event type as Method.
+// ok is false when ret is not an event envelope.
+func parseDexRouterEvents(ret string, blockHeight uint64, txID string) ([]VSCEvent, bool) {
+	var envelope dexEventEnvelope
+	if err := json.Unmarshal([]byte(ret), &envelope); err != nil || envelope.V == 0 || envelope.Events == nil {
+		return nil, false
+	}
+
+	events := make([]VSCEvent, 0, len(envelope.Events))
+	for _, raw := range envelope.Events {
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(raw, &header); err != nil || header.Type == "" {
+			continue
+		}
+		// The envelope identifies the dex-router event schema regardless of
+		// the ID the contract is deployed under
+		events = append(events, VSCEvent{
+			Type:        "contract_output",
+			Contract:    "dex-router",
+			Method:      header.Type,
+			Args:        raw,
+			BlockHeight: blockHeight,
+			TxID:        txID,
+		})
+	}
+
+	return events, true
+}
+
 // handleEvent processes an incoming VSC event
 func (s *Service) handleEvent(event VSCEvent) {
 	s.mu.RLock()
@@ -33,7 +33,9 @@ func (dm *DexReadModel) HandleEvent(event VSCEvent) error {
 
 // handleDexRouterEvent processes DEX router events
 func (dm *DexReadModel) handleDexRouterEvent(event VSCEvent) error {
-	// Handle pool creation, liquidity changes, and swaps from unified contract
+	// Handle pool creation, liquidity changes, and swaps from unified contract.
+	// Versioned contract events carry the reserves after the change, which are
+	// applied as-is; older events without them are applied as deltas.
 	switch event.Method {
 	case "pool_created":
 		var args struct {
@@ -41,48 +43,111 @@ func (dm *DexReadModel) handleDexRouterEvent(event VSCEvent) error {
 			Asset0 string  `json:"asset0"`
 			Asset1 string  `json:"asset1"`
 			Fee    float64 `json:"fee"`
+			FeeBps *uint64 `json:"fee_bps"`
+			Type   string  `json:"pool_type"`
+			Amp    uint64  `json:"amp"`
 		}
 		if err := json.Unmarshal(event.Args, &args); err != nil {
 			return err
 		}
 
+		fee := args.Fee
+		if args.FeeBps != nil {
+			fee = float64(*args.FeeBps) / 100 // basis points to percent
+		}
+
 		dm.pools[args.PoolID] = PoolInfo{
 			ID:       args.PoolID,
 			Asset0:   args.Asset0,
 			Asset1:   args.Asset1,
-			Fee:      args.Fee,
+			Fee:      fee,
 			Reserve0: 0,
 			Reserve1: 0,
+			Type:     args.Type,
+			Amp:      args.Amp,
+		}
+	case "pool_fee_updated":
+		var args struct {
+			PoolID string `json:"pool_id"`
+			FeeBps uint64 `json:"fee_bps"`
+		}
+		if err := json.Unmarshal(event.Args, &args); err != nil {
+			return err
+		}
+
+		if pool, exists := dm.pools[args.PoolID]; exists {
+			pool.Fee = float64(args.FeeBps) / 100
+			dm.pools[args.PoolID] = pool
 		}
 	case "liquidity_added":
+		var args struct {
+			PoolID   string  `json:"pool_id"`
+			Amount0  uint64  `json:"amount0"`
+			Amount1  uint64  `json:"amount1"`
+			Reserve0 *uint64 `json:"reserve0"`
+			Reserve1 *uint64 `json:"reserve1"`
+		}
+		if err := json.Unmarshal(event.Args, &args); err != nil {
+			return err
+		}
+
+		if pool, exists := dm.pools[args.PoolID]; exists {
+			if !setReserves(&pool, args.Reserve0, args.Reserve1) {
+				pool.Reserve0 += args.Amount0
+				pool.Reserve1 += args.Amount1
+				pool.TotalSupply += args.Amount0 // Simplified LP token calculation
+			}
+			dm.pools[args.PoolID] = pool
+		}
+	case "liquidity_removed":
+		var args struct {
+			PoolID   string  `json:"pool_id"`
+			Amount0  uint64  `json:"amount0"`
+			Amount1  uint64  `json:"amount1"`
+			Reserve0 *uint64 `json:"reserve0"`
+			Reserve1 *uint64 `json:"reserve1"`
+		}
+		if err := json.Unmarshal(event.Args, &args); err != nil {
+			return err
+		}
+
+		if pool, exists := dm.pools[args.PoolID]; exists {
+			if !setReserves(&pool, args.Reserve0, args.Reserve1) {
+				pool.Reserve0 -= args.Amount0
+				pool.Reserve1 -= args.Amount1
+			}
+			dm.pools[args.PoolID] = pool
+		}
+	case "lp_minted", "lp_burned":
 		var args struct {
 			PoolID  string `json:"pool_id"`
-			Amount0 uint64 `json:"amount0"`
-			Amount1 uint64 `json:"amount1"`
+			TotalLP uint64 `json:"total_lp"`
 		}
 		if err := json.Unmarshal(event.Args, &args); err != nil {
 			return err
 		}
 
 		if pool, exists := dm.pools[args.PoolID]; exists {
-			pool.Reserve0 += args.Amount0
-			pool.Reserve1 += args.Amount1
-			pool.TotalSupply += args.Amount0 // Simplified LP token calculation
+			pool.TotalSupply = args.TotalLP
 			dm.pools[args.PoolID] = pool
 		}
 	case "swap_executed":
 		var args struct {
-			PoolID  string `json:"pool_id"`
-			Amount0 int64  `json:"amount0"` // Reserve change for asset0
-			Amount1 int64  `json:"amount1"` // Reserve change for asset1
+			PoolID   string  `json:"pool_id"`
+			Amount0  int64   `json:"amount0"` // Reserve change for asset0
+			Amount1  int64   `json:"amount1"` // Reserve change for asset1
+			Reserve0 *uint64 `json:"reserve0"`
+			Reserve1 *uint64 `json:"reserve1"`
 		}
 		if err := json.Unmarshal(event.Args, &args); err != nil {
 			return err
 		}
 
 		if pool, exists := dm.pools[args.PoolID]; exists {
-			pool.Reserve0 = uint64(int64(pool.Reserve0) + args.Amount0)
-			pool.Reserve1 = uint64(int64(pool.Reserve1) + args.Amount1)
+			if !setReserves(&pool, args.Reserve0, args.Reserve1) {
+				pool.Reserve0 = uint64(int64(pool.Reserve0) + args.Amount0)
+				pool.Reserve1 = uint64(int64(pool.Reserve1) + args.Amount1)
+			}
 			dm.pools[args.PoolID] = pool
 		}
 	}
@@ -90,7 +155,15 @@ func (dm *DexReadModel) handleDexRouterEvent(event VSCEvent) error {
 	return nil
 }
 
-
+// setReserves applies post-event reserves when the event carries both
+func setReserves(pool *PoolInfo, reserve0, reserve1 *uint64) bool {
+	if reserve0 == nil || reserve1 == nil {
+		return false
+	}
+	pool.Reserve0 = *reserve0
+	pool.Reserve1 = *reserve1
+	return true
+}
 
 // QueryPools returns all indexed pools
 func (dm *DexReadModel) QueryPools() ([]PoolInfo, error) {
@@ -192,3 +192,65 @@ func TestDexReadModel_GetPool(t *testing.T) {
 	assert.False(t, exists)
 	assert.Equal(t, PoolInfo{}, pool)
 }
+
+func TestDexReadModel_ReplayContractEvents(t *testing.T) {
+	rm := NewDexReadModel()
+
+	// Results of create_pool, a deposit, a swap, a withdrawal and a fee
+	// update, in order
+	results := []string{
+		`{"v":1,"events":[{"v":1,"type":"pool_created","pool_id":"1","asset0":"HBD","asset1":"HIVE","fee_bps":8}]}`,
+		`{"v":1,"events":[
+			{"v":1,"type":"liquidity_added","pool_id":"1","provider":"hive:alice","amount0":1000000,"amount1":500000,"reserve0":1000000,"reserve1":500000},
+			{"v":1,"type":"lp_minted","pool_id":"1","to":"hive:alice","amount":707106,"total_lp":707106}
+		]}`,
+		`{"v":1,"events":[{"v":1,"type":"swap_executed","pool_id":"1","asset_in":"HBD","asset_out":"HIVE","amount_in":100000,"amount_out":45421,"fee":80,"reserve0":1099920,"reserve1":454579}]}`,
+		`{"v":1,"events":[
+			{"v":1,"type":"liquidity_removed","pool_id":"1","provider":"hive:alice","amount0":109992,"amount1":45457,"reserve0":989928,"reserve1":409122},
+			{"v":1,"type":"lp_burned","pool_id":"1","from":"hive:alice","amount":70710,"total_lp":636396}
+		]}`,
+		`{"v":1,"events":[{"v":1,"type":"pool_fee_updated","pool_id":"1","fee_bps":30,"old_fee_bps":8}]}`,
+	}
+
+	for i, ret := range results {
+		events, ok := parseDexRouterEvents(ret, uint64(i+1), "tx")
+		require.True(t, ok)
+		for _, event := range events {
+			require.NoError(t, rm.HandleEvent(event))
+		}
+	}
+
+	pool, exists := rm.GetPool("1")
+	require.True(t, exists)
+	assert.Equal(t, "HBD", pool.Asset0)
+	assert.Equal(t, "HIVE", pool.Asset1)
+	assert.Equal(t, 0.3, pool.Fee)
+	assert.Equal(t, uint64(989928), pool.Reserve0)
+	assert.Equal(t, uint64(409122), pool.Reserve1)
+	assert.Equal(t, uint64(636396), pool.TotalSupply)
+}
+
+func TestDexReadModel_HandleEvent_StableSwapPoolCreated(t *testing.T) {
+	rm := NewDexReadModel()
+
+	events, ok := parseDexRouterEvents(
+		`{"v":1,"events":[{"v":1,"type":"pool_created","pool_id":"2","asset0":"HBD","asset1":"HIVE","fee_bps":4,"protocol_share_bps":10000,"pool_type":"stableswap","amp":100}]}`,
+		1, "tx")
+	require.True(t, ok)
+	for _, event := range events {
+		require.NoError(t, rm.HandleEvent(event))
+	}
+
+	pool, exists := rm.GetPool("2")
+	require.True(t, exists)
+	assert.Equal(t, "stableswap", pool.Type)
+	assert.Equal(t, uint64(100), pool.Amp)
+	assert.Equal(t, 0.04, pool.Fee)
+}
+
+func TestParseDexRouterEvents_NotAnEnvelope(t *testing.T) {
+	for _, ret := range []string{"", "pool not found", `{"asset0":"HBD"}`, `{"error":"E_POOL_NOT_FOUND","message":"pool not found"}`} {
+		_, ok := parseDexRouterEvents(ret, 1, "tx")
+		assert.False(t, ok, ret)
+	}
+}
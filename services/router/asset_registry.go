@@ -0,0 +1,98 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AssetInfo is an entry of the dex-router contract's asset registry
+type AssetInfo struct {
+	Symbol   string `json:"symbol"`
+	Decimals uint64 `json:"decimals"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// AssetRegistry looks up assets in the contract's registry. A nil info with
+// a nil error means the asset is not registered.
+type AssetRegistry interface {
+	GetAsset(ctx context.Context, symbol string) (*AssetInfo, error)
+}
+
+// ContractQuerier runs a read-only action of the dex-router contract and
+// returns its result
+type ContractQuerier interface {
+	QueryContract(ctx context.Context, action string, payload string) (string, error)
+}
+
+// CachedAssetRegistry implements AssetRegistry with the contract's get_asset
+// action, keeping each answer, including "not registered", for ttl
+type CachedAssetRegistry struct {
+	querier ContractQuerier
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedAsset
+}
+
+type cachedAsset struct {
+	info    *AssetInfo
+	expires time.Time
+}
+
+// NewCachedAssetRegistry creates a registry reading through querier
+func NewCachedAssetRegistry(querier ContractQuerier, ttl time.Duration) *CachedAssetRegistry {
+	return &CachedAssetRegistry{
+		querier: querier,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedAsset),
+	}
+}
+
+// GetAsset returns the registry entry for symbol
+func (c *CachedAssetRegistry) GetAsset(ctx context.Context, symbol string) (*AssetInfo, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[symbol]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.info, nil
+	}
+
+	info, err := c.queryAsset(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[symbol] = cachedAsset{info: info, expires: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+	return info, nil
+}
+
+func (c *CachedAssetRegistry) queryAsset(ctx context.Context, symbol string) (*AssetInfo, error) {
+	ret, err := c.querier.QueryContract(ctx, "get_asset", symbol)
+	if err != nil {
+		var contractErr *ContractError
+		if errors.As(err, &contractErr) && contractErr.Code == "E_UNKNOWN_ASSET" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get_asset %s: %w", symbol, err)
+	}
+	if contractErr, ok := ParseContractError(ret); ok {
+		if contractErr.Code == "E_UNKNOWN_ASSET" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get_asset %s: %w", symbol, contractErr)
+	}
+
+	var info AssetInfo
+	if err := json.Unmarshal([]byte(ret), &info); err != nil {
+		return nil, fmt.Errorf("failed to decode get_asset result: %w", err)
+	}
+	return &info, nil
+}
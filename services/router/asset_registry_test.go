@@ -0,0 +1,103 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockContractQuerier answers get_asset from a fixed registry, the way the
+// contract does
+type mockContractQuerier struct {
+	assets  map[string]string // symbol -> get_asset result
+	queries int
+	err     error
+}
+
+func (m *mockContractQuerier) QueryContract(ctx context.Context, action string, payload string) (string, error) {
+	m.queries++
+	if m.err != nil {
+		return "", m.err
+	}
+	if ret, ok := m.assets[payload]; ok {
+		return ret, nil
+	}
+	return `{"error":"E_UNKNOWN_ASSET","message":"unknown asset ` + payload + `"}`, nil
+}
+
+func testAssetQuerier() *mockContractQuerier {
+	return &mockContractQuerier{assets: map[string]string{
+		"HBD":  `{"symbol":"HBD","decimals":3,"enabled":true}`,
+		"HIVE": `{"symbol":"HIVE","decimals":3,"enabled":true}`,
+		"BTC":  `{"symbol":"BTC","decimals":8,"enabled":false}`,
+	}}
+}
+
+func TestCachedAssetRegistry(t *testing.T) {
+	querier := testAssetQuerier()
+	registry := NewCachedAssetRegistry(querier, time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+
+	info, err := registry.GetAsset(context.Background(), "BTC")
+	require.NoError(t, err)
+	assert.Equal(t, &AssetInfo{Symbol: "BTC", Decimals: 8, Enabled: false}, info)
+
+	info, err = registry.GetAsset(context.Background(), "DOGE")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	// Answers, including unknown assets, are cached until the ttl passes
+	registry.GetAsset(context.Background(), "BTC")
+	registry.GetAsset(context.Background(), "DOGE")
+	assert.Equal(t, 2, querier.queries)
+	now = now.Add(2 * time.Minute)
+	registry.GetAsset(context.Background(), "BTC")
+	assert.Equal(t, 3, querier.queries)
+
+	// Query failures are reported and not cached
+	querier.err = errors.New("node unreachable")
+	_, err = registry.GetAsset(context.Background(), "HIVE")
+	assert.ErrorContains(t, err, "node unreachable")
+	querier.err = nil
+	info, err = registry.GetAsset(context.Background(), "HIVE")
+	require.NoError(t, err)
+	assert.True(t, info.Enabled)
+}
+
+func TestExecuteSwapAssetRegistry(t *testing.T) {
+	mockExecutor := &mockDEXExecutor{}
+	svc := NewService(VSCConfig{DexRouterContract: "dex-router-contract"}, mockExecutor)
+	svc.SetAssetRegistry(NewCachedAssetRegistry(testAssetQuerier(), time.Minute))
+
+	tests := []struct {
+		name    string
+		params  SwapParams
+		code    string
+		message string
+	}{
+		{"unknown asset_out", SwapParams{AssetIn: "HBD", AssetOut: "DOGE"}, "E_UNKNOWN_ASSET", "unknown asset DOGE"},
+		{"disabled asset_in", SwapParams{AssetIn: "BTC", AssetOut: "HBD"}, "E_ASSET_DISABLED", "asset BTC disabled"},
+		{"unknown path asset", SwapParams{AssetIn: "HBD", AssetOut: "HIVE", Path: []string{"HBD", "DOGE", "HIVE"}}, "E_UNKNOWN_ASSET", "unknown asset DOGE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.AmountIn, tt.params.Sender = 1000, "test-user"
+			result, err := svc.ExecuteSwap(tt.params)
+			require.NoError(t, err)
+			assert.False(t, result.Success)
+			assert.Equal(t, tt.code, result.ErrorCode)
+			assert.Equal(t, tt.message, result.ErrorMessage)
+		})
+	}
+	assert.Empty(t, mockExecutor.executedOperations)
+
+	result, err := svc.ExecuteSwap(SwapParams{AssetIn: "HBD", AssetOut: "HIVE", AmountIn: 1000, Sender: "test-user"})
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Len(t, mockExecutor.executedOperations, 1)
+}
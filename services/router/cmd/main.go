@@ -35,6 +35,7 @@ func main() {
 		port           = flag.String("port", "8080", "HTTP server port")
 		indexerEndpoint = flag.String("indexer-endpoint", "http://localhost:8081", "Indexer service HTTP endpoint")
 		dexRouter      = flag.String("dex-router-contract", "", "DEX router contract ID")
+		assetCacheTTL  = flag.Duration("asset-cache-ttl", time.Minute, "How long asset registry lookups are cached")
 	)
 	flag.Parse()
 
@@ -69,6 +70,15 @@ func main() {
 		log.Printf("Warning: No indexer endpoint provided, router will use hardcoded fallback pools")
 	}
 	
+	// Check swap assets against the contract's asset registry
+	if *dexRouter != "" {
+		assetQuerier := router.NewVSCStateQuerier(*vscNode, *dexRouter)
+		svc.SetAssetRegistry(router.NewCachedAssetRegistry(assetQuerier, *assetCacheTTL))
+		log.Printf("Router checking assets against contract %s", *dexRouter)
+	} else {
+		log.Printf("Warning: No DEX router contract provided, swap assets will not be checked")
+	}
+
 	server := router.NewServer(svc, *port)
 
 	// Handle graceful shutdown
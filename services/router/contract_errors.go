@@ -0,0 +1,80 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ContractError is a failure returned by the dex-router contract, e.g.
+// {"error":"E_POOL_NOT_FOUND","message":"pool not found"}. Code is stable;
+// Message is for humans and may change.
+type ContractError struct {
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *ContractError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// HTTPStatus maps the error code to the status the router API answers with
+func (e *ContractError) HTTPStatus() int {
+	if status, ok := contractErrorStatus[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Status for each code of the contract's error catalogue (contracts/dex-router/errors.go)
+var contractErrorStatus = map[string]int{
+	"E_INVALID_PAYLOAD":        http.StatusBadRequest,
+	"E_INVALID_PARAM":          http.StatusBadRequest,
+	"E_INVALID_PATH":           http.StatusBadRequest,
+	"E_FEE_TIER_REQUIRED":      http.StatusBadRequest,
+	"E_UNKNOWN_ASSET":          http.StatusBadRequest,
+	"E_RETURN_ADDRESS":         http.StatusBadRequest,
+	"E_UNAUTHORIZED":           http.StatusForbidden,
+	"E_INTENT_MISSING":         http.StatusForbidden,
+	"E_INTENT_INVALID":         http.StatusForbidden,
+	"E_INTENT_EXCEEDED":        http.StatusForbidden,
+	"E_POOL_NOT_FOUND":         http.StatusNotFound,
+	"E_ALREADY_INITIALIZED":    http.StatusConflict,
+	"E_POOL_EXISTS":            http.StatusConflict,
+	"E_ASSET_EXISTS":           http.StatusConflict,
+	"E_SLIPPAGE":               http.StatusUnprocessableEntity,
+	"E_MIN_OUTPUT":             http.StatusUnprocessableEntity,
+	"E_EXPIRED":                http.StatusUnprocessableEntity,
+	"E_ZERO_RESERVES":          http.StatusUnprocessableEntity,
+	"E_INSUFFICIENT_LIQUIDITY": http.StatusUnprocessableEntity,
+	"E_INSUFFICIENT_LP":        http.StatusUnprocessableEntity,
+	"E_INSUFFICIENT_ALLOWANCE": http.StatusUnprocessableEntity,
+	"E_LOCKED_LIQUIDITY":       http.StatusUnprocessableEntity,
+	"E_OVERFLOW":               http.StatusUnprocessableEntity,
+	"E_PRICE_HISTORY":          http.StatusUnprocessableEntity,
+	"E_CLAIM_INTERVAL":         http.StatusTooManyRequests,
+	"E_ASSET_DISABLED":         http.StatusServiceUnavailable,
+	"E_POOL_PAUSED":            http.StatusServiceUnavailable,
+	"E_REFUND_UNAVAILABLE":     http.StatusServiceUnavailable,
+	"E_INTERNAL":               http.StatusInternalServerError,
+}
+
+// ParseContractError reads a contract call result; ok is false when the
+// result is not an error
+func ParseContractError(ret string) (*ContractError, bool) {
+	var e ContractError
+	if err := json.Unmarshal([]byte(ret), &e); err != nil || e.Code == "" {
+		return nil, false
+	}
+	return &e, true
+}
+
+// contractErrorOf returns the contract error behind err, whether the executor
+// wrapped a ContractError or passed the contract's result on as the error text
+func contractErrorOf(err error) (*ContractError, bool) {
+	var contractErr *ContractError
+	if errors.As(err, &contractErr) {
+		return contractErr, true
+	}
+	return ParseContractError(err.Error())
+}
@@ -0,0 +1,46 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContractError(t *testing.T) {
+	contractErr, ok := ParseContractError(`{"error":"E_SLIPPAGE","message":"slippage tolerance exceeded"}`)
+	require.True(t, ok)
+	assert.Equal(t, "E_SLIPPAGE", contractErr.Code)
+	assert.Equal(t, "slippage tolerance exceeded", contractErr.Message)
+	assert.Equal(t, "E_SLIPPAGE: slippage tolerance exceeded", contractErr.Error())
+
+	// Successful results are not errors
+	for _, ret := range []string{"", "pool not found", `{"v":1,"events":[]}`, `{"pool_id":"1"}`} {
+		_, ok := ParseContractError(ret)
+		assert.False(t, ok, ret)
+	}
+}
+
+func TestContractErrorHTTPStatus(t *testing.T) {
+	tests := []struct {
+		code   string
+		status int
+	}{
+		{"E_INVALID_PAYLOAD", http.StatusBadRequest},
+		{"E_UNAUTHORIZED", http.StatusForbidden},
+		{"E_INTENT_EXCEEDED", http.StatusForbidden},
+		{"E_POOL_NOT_FOUND", http.StatusNotFound},
+		{"E_POOL_EXISTS", http.StatusConflict},
+		{"E_SLIPPAGE", http.StatusUnprocessableEntity},
+		{"E_POOL_PAUSED", http.StatusServiceUnavailable},
+		{"E_CLAIM_INTERVAL", http.StatusTooManyRequests},
+		{"E_SOMETHING_NEW", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			assert.Equal(t, tt.status, (&ContractError{Code: tt.code}).HTTPStatus())
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// VSCStateQuerier implements ContractQuerier against a VSC node's GraphQL
+// API. The node cannot run contract actions read-only, so the supported
+// actions are answered from the contract state they read, in the same result
+// format the contract returns.
+type VSCStateQuerier struct {
+	endpoint   string
+	contractID string
+	httpClient *http.Client
+}
+
+// NewVSCStateQuerier creates a querier for the dex-router contract contractID
+// on the node at endpoint
+func NewVSCStateQuerier(endpoint string, contractID string) *VSCStateQuerier {
+	return &VSCStateQuerier{
+		endpoint:   endpoint,
+		contractID: contractID,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// QueryContract runs a read-only dex-router action. Only get_asset is
+// supported.
+func (q *VSCStateQuerier) QueryContract(ctx context.Context, action string, payload string) (string, error) {
+	switch action {
+	case "get_asset":
+		return q.getAsset(ctx, payload)
+	default:
+		return "", fmt.Errorf("unsupported contract query: %s", action)
+	}
+}
+
+// getAsset mirrors the contract's get_asset over its asset/{symbol}/... keys
+func (q *VSCStateQuerier) getAsset(ctx context.Context, symbol string) (string, error) {
+	decimalsKey := "asset/" + symbol + "/decimals"
+	enabledKey := "asset/" + symbol + "/enabled"
+	state, err := q.getStateByKeys(ctx, []string{decimalsKey, enabledKey})
+	if err != nil {
+		return "", err
+	}
+
+	rawDecimals, ok := state[decimalsKey].(string)
+	if !ok || rawDecimals == "" {
+		ret, _ := json.Marshal(map[string]string{
+			"error":   "E_UNKNOWN_ASSET",
+			"message": "unknown asset " + symbol,
+		})
+		return string(ret), nil
+	}
+	decimals, err := strconv.ParseUint(rawDecimals, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid decimals for %s: %q", symbol, rawDecimals)
+	}
+	enabled, _ := state[enabledKey].(string)
+
+	ret, err := json.Marshal(AssetInfo{
+		Symbol:   symbol,
+		Decimals: decimals,
+		Enabled:  enabled == "true",
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func (q *VSCStateQuerier) getStateByKeys(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": `query GetStateByKeys($contractId: String!, $keys: [String!]!) {
+			getStateByKeys(contractId: $contractId, keys: $keys)
+		}`,
+		"variables": map[string]interface{}{
+			"contractId": q.contractID,
+			"keys":       keys,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal GraphQL request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", q.endpoint+"/api/v1/graphql", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query VSC node: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("VSC node returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			GetStateByKeys map[string]interface{} `json:"getStateByKeys"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode state response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL error: %s", result.Errors[0].Message)
+	}
+	return result.Data.GetStateByKeys, nil
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStateServer serves getStateByKeys for the dex-router contract's state
+func newStateServer(t *testing.T, state map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/graphql", r.URL.Path)
+		assert.Equal(t, "POST", r.Method)
+
+		var req struct {
+			Variables struct {
+				ContractID string   `json:"contractId"`
+				Keys       []string `json:"keys"`
+			} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "dex_router", req.Variables.ContractID)
+
+		values := make(map[string]interface{})
+		for _, key := range req.Variables.Keys {
+			if v, ok := state[key]; ok {
+				values[key] = v
+			} else {
+				values[key] = nil
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"getStateByKeys": values},
+		})
+	}))
+}
+
+func TestVSCStateQuerierGetAsset(t *testing.T) {
+	server := newStateServer(t, map[string]string{
+		"asset/HBD/decimals": "3",
+		"asset/HBD/enabled":  "true",
+		"asset/BTC/decimals": "8",
+		"asset/BTC/enabled":  "false",
+	})
+	defer server.Close()
+
+	querier := NewVSCStateQuerier(server.URL, "dex_router")
+	ctx := context.Background()
+
+	ret, err := querier.QueryContract(ctx, "get_asset", "HBD")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"symbol":"HBD","decimals":3,"enabled":true}`, ret)
+
+	ret, err = querier.QueryContract(ctx, "get_asset", "ETH")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"error":"E_UNKNOWN_ASSET","message":"unknown asset ETH"}`, ret)
+
+	_, err = querier.QueryContract(ctx, "list_assets", "")
+	assert.Error(t, err)
+
+	// The registry reads through the querier
+	registry := NewCachedAssetRegistry(querier, 0)
+	info, err := registry.GetAsset(ctx, "BTC")
+	require.NoError(t, err)
+	assert.Equal(t, &AssetInfo{Symbol: "BTC", Decimals: 8, Enabled: false}, info)
+	info, err = registry.GetAsset(ctx, "ETH")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func TestVSCStateQuerierErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []map[string]string{{"message": "contract not found"}},
+		})
+	}))
+	defer server.Close()
+
+	_, err := NewVSCStateQuerier(server.URL, "dex_router").QueryContract(context.Background(), "get_asset", "HBD")
+	assert.EqualError(t, err, "GraphQL error: contract not found")
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err = NewVSCStateQuerier(server.URL, "dex_router").QueryContract(context.Background(), "get_asset", "HBD")
+	assert.EqualError(t, err, "VSC node returned status 500")
+}
@@ -7,12 +7,17 @@ import (
 )
 
 // InstructionToSwapParams converts a SwapInstruction to SwapParams for routing
-// amountIn should be provided from the deposit/transaction amount
+// amountIn should be provided from the deposit/transaction amount; when it is
+// zero the instruction's own amount_in is used instead
 func InstructionToSwapParams(instruction *schemas.SwapInstruction, amountIn int64) (*SwapParams, error) {
 	if instruction == nil {
 		return nil, fmt.Errorf("instruction cannot be nil")
 	}
 
+	if amountIn == 0 && instruction.AmountIn != nil {
+		amountIn = *instruction.AmountIn
+	}
+
 	// Set default slippage to 50 basis points (0.5%) if not provided
 	maxSlippage := uint64(50)
 	if instruction.SlippageBps != nil {
@@ -36,16 +41,26 @@ func InstructionToSwapParams(instruction *schemas.SwapInstruction, amountIn int6
 		refBps = uint64(*instruction.RefBps)
 	}
 
+	// Pin the fee tier when the instruction names one
+	feeBps := uint64(0)
+	if instruction.FeeBps != nil {
+		feeBps = uint64(*instruction.FeeBps)
+	}
+
 	return &SwapParams{
 		Sender:         instruction.Recipient,
 		AmountIn:       amountIn,
 		AssetIn:        instruction.AssetIn,
 		AssetOut:       instruction.AssetOut,
 		MinAmountOut:   minAmountOut,
+		Path:           instruction.Path,
+		FeeBps:         feeBps,
 		MaxSlippage:    maxSlippage,
 		MiddleOutRatio: 0, // Default value, can be adjusted based on routing logic
 		Beneficiary:    beneficiary,
 		RefBps:         refBps,
+		Deadline:       instruction.Deadline,
+		ReturnAddress:  instruction.ReturnAddr,
 	}, nil
 }
 
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vsc-eco/vsc-dex-mapping/schemas"
+)
+
+func TestInstructionToSwapParamsFeeBps(t *testing.T) {
+	feeBps := 30
+	instruction := &schemas.SwapInstruction{
+		InstructionType: "swap",
+		SchemaVersion:   "1.0.0",
+		AssetIn:         "HBD",
+		AssetOut:        "HIVE",
+		Recipient:       "hive:alice",
+		FeeBps:          &feeBps,
+	}
+
+	params, err := InstructionToSwapParams(instruction, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(30), params.FeeBps)
+
+	// Without fee_bps the contract picks the tier
+	instruction.FeeBps = nil
+	params, err = InstructionToSwapParams(instruction, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), params.FeeBps)
+}
+
+func TestParseAndConvertInstructionForwardsFeeBps(t *testing.T) {
+	data := []byte(`{
+		"type": "swap",
+		"version": "1.0.0",
+		"asset_in": "HBD",
+		"asset_out": "HIVE",
+		"recipient": "hive:alice",
+		"min_amount_out": 90,
+		"fee_bps": 30
+	}`)
+
+	params, err := ParseAndConvertInstruction(data, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(30), params.FeeBps)
+
+	mockExecutor := &mockDEXExecutor{}
+	svc := NewService(VSCConfig{DexRouterContract: "dex-router-contract"}, mockExecutor)
+	result, err := svc.ExecuteSwap(*params)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	require.Len(t, mockExecutor.executedOperations, 1)
+	payloadStr := strings.TrimPrefix(mockExecutor.executedOperations[0], "execute:")
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(payloadStr), &payload))
+	assert.Equal(t, float64(30), payload["fee_bps"])
+}
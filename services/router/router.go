@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+
+	"github.com/vsc-eco/vsc-dex-mapping/schemas"
 )
 
 // DEXExecutor interface for executing DEX operations
@@ -17,6 +19,7 @@ type DEXExecutor interface {
 type Service struct {
 	vscConfig   VSCConfig
 	dexExecutor DEXExecutor
+	assets      AssetRegistry // optional; swaps are checked against it when set
 }
 
 type VSCConfig struct {
@@ -33,10 +36,14 @@ type SwapParams struct {
 	AssetIn        string
 	AssetOut       string
 	MinAmountOut   int64
+	Path           []string
+	FeeBps         uint64 // pins the pool fee tier; 0 lets the contract pick the best-output tier
 	MaxSlippage    uint64
 	MiddleOutRatio float64
 	Beneficiary    string
 	RefBps         uint64
+	Deadline       *schemas.Deadline      // optional expiry forwarded to the contract
+	ReturnAddress  *schemas.ReturnAddress // where the contract refunds a failed swap
 }
 
 // DepositParams represents a deposit request
@@ -62,6 +69,7 @@ type SwapResult struct {
 	Fee          int64
 	Route        []string
 	ErrorMessage string
+	ErrorCode    string // contract error code (see ContractError), when the contract rejected the swap
 }
 
 
@@ -74,6 +82,9 @@ func (r *Service) ExecuteSwap(params SwapParams) (*SwapResult, error) {
 			ErrorMessage: "cannot swap asset to itself",
 		}, nil
 	}
+	if result := r.checkAssets(params); result != nil {
+		return result, nil
+	}
 
 	// Construct JSON payload according to schema
 	payload := map[string]interface{}{
@@ -86,6 +97,15 @@ func (r *Service) ExecuteSwap(params SwapParams) (*SwapResult, error) {
 	}
 
 	// Add optional fields
+	if params.AmountIn > 0 {
+		payload["amount_in"] = params.AmountIn
+	}
+	if len(params.Path) > 0 {
+		payload["path"] = params.Path
+	}
+	if params.FeeBps > 0 {
+		payload["fee_bps"] = int(params.FeeBps)
+	}
 	if params.MaxSlippage > 0 {
 		payload["slippage_bps"] = int(params.MaxSlippage)
 	}
@@ -95,6 +115,12 @@ func (r *Service) ExecuteSwap(params SwapParams) (*SwapResult, error) {
 	if params.RefBps > 0 {
 		payload["ref_bps"] = int(params.RefBps)
 	}
+	if params.Deadline != nil {
+		payload["deadline"] = params.Deadline
+	}
+	if params.ReturnAddress != nil {
+		payload["return_address"] = params.ReturnAddress
+	}
 
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -107,10 +133,19 @@ func (r *Service) ExecuteSwap(params SwapParams) (*SwapResult, error) {
 	// Execute through DEX executor
 	err = r.dexExecutor.ExecuteDexOperation(context.Background(), "execute", string(payloadBytes))
 	if err != nil {
-		return &SwapResult{
+		result := &SwapResult{
 			Success:      false,
 			ErrorMessage: fmt.Sprintf("swap execution failed: %v", err),
-		}, nil
+		}
+		if contractErr, ok := contractErrorOf(err); ok {
+			result.ErrorCode = contractErr.Code
+		}
+		return result, nil
+	}
+
+	route := []string{"direct"}
+	if len(params.Path) > 0 {
+		route = params.Path
 	}
 
 	// For now, return success - in practice, we'd parse the contract response
@@ -118,10 +153,45 @@ func (r *Service) ExecuteSwap(params SwapParams) (*SwapResult, error) {
 	return &SwapResult{
 		Success:   true,
 		AmountOut: params.MinAmountOut, // Placeholder - would come from contract
-		Route:     []string{"direct"},
+		Route:     route,
 	}, nil
 }
 
+// checkAssets rejects swaps naming an asset the contract's registry does not
+// know or has disabled, with the contract's own error code. It returns nil
+// when every asset is enabled or no registry is set.
+func (r *Service) checkAssets(params SwapParams) *SwapResult {
+	if r.assets == nil {
+		return nil
+	}
+
+	assets := append([]string{params.AssetIn, params.AssetOut}, params.Path...)
+	for _, asset := range assets {
+		info, err := r.assets.GetAsset(context.Background(), asset)
+		if err != nil {
+			return &SwapResult{
+				Success:      false,
+				ErrorMessage: fmt.Sprintf("asset registry unavailable: %v", err),
+			}
+		}
+		if info == nil {
+			return &SwapResult{
+				Success:      false,
+				ErrorMessage: "unknown asset " + asset,
+				ErrorCode:    "E_UNKNOWN_ASSET",
+			}
+		}
+		if !info.Enabled {
+			return &SwapResult{
+				Success:      false,
+				ErrorMessage: "asset " + asset + " disabled",
+				ErrorCode:    "E_ASSET_DISABLED",
+			}
+		}
+	}
+	return nil
+}
+
 // ExecuteDeposit executes a liquidity deposit
 func (s *Service) ExecuteDeposit(params DepositParams) (*SwapResult, error) {
 	// Construct JSON payload for deposit
@@ -198,6 +268,12 @@ func NewService(config VSCConfig, dexExecutor DEXExecutor) *Service {
 	}
 }
 
+// SetAssetRegistry makes swaps check their assets against the contract's
+// asset registry before they are submitted
+func (s *Service) SetAssetRegistry(registry AssetRegistry) {
+	s.assets = registry
+}
+
 // ComputeRoute finds the optimal route for a swap (external API method)
 func (s *Service) ComputeRoute(ctx context.Context, params SwapParams) (*SwapResult, error) {
 	return s.ExecuteSwap(params)
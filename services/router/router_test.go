@@ -3,22 +3,25 @@ package router
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vsc-eco/vsc-dex-mapping/schemas"
 )
 
 // mockDEXExecutor implements DEXExecutor for testing
 type mockDEXExecutor struct {
 	executedOperations []string // Track executed operations for testing
+	err                error    // returned by ExecuteDexOperation when set
 }
 
 func (m *mockDEXExecutor) ExecuteDexOperation(ctx context.Context, operationType string, payload string) error {
 	// Track the operation for testing
 	m.executedOperations = append(m.executedOperations, operationType+":"+payload)
-	return nil
+	return m.err
 }
 
 func (m *mockDEXExecutor) ExecuteDexSwap(ctx context.Context, amountOut int64, route []string, fee int64) error {
@@ -84,12 +87,106 @@ func TestExecuteSwap(t *testing.T) {
 	assert.Equal(t, "HBD", instruction["asset_in"])
 	assert.Equal(t, "HIVE", instruction["asset_out"])
 	assert.Equal(t, "test-user", instruction["recipient"])
+	assert.Equal(t, float64(1000000), instruction["amount_in"])
 	assert.Equal(t, float64(900000), instruction["min_amount_out"])
 	assert.Equal(t, float64(50), instruction["slippage_bps"])
 	assert.Equal(t, "ref-user", instruction["beneficiary"])
 	assert.Equal(t, float64(25), instruction["ref_bps"])
 }
 
+func TestExecuteSwapWithPath(t *testing.T) {
+	mockExecutor := &mockDEXExecutor{}
+	config := VSCConfig{DexRouterContract: "dex-router-contract"}
+	svc := NewService(config, mockExecutor)
+
+	params := SwapParams{
+		AssetIn:  "BTC",
+		AssetOut: "HBD",
+		AmountIn: 100000,
+		Path:     []string{"BTC", "HIVE", "HBD"},
+		Sender:   "test-user",
+	}
+
+	result, err := svc.ExecuteSwap(params)
+
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, []string{"BTC", "HIVE", "HBD"}, result.Route)
+
+	require.Len(t, mockExecutor.executedOperations, 1)
+	payload := strings.TrimPrefix(mockExecutor.executedOperations[0], "execute:")
+	var instruction map[string]interface{}
+	err = json.Unmarshal([]byte(payload), &instruction)
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{"BTC", "HIVE", "HBD"}, instruction["path"])
+}
+
+func TestExecuteSwapWithDeadline(t *testing.T) {
+	mockExecutor := &mockDEXExecutor{}
+	config := VSCConfig{DexRouterContract: "dex-router-contract"}
+	svc := NewService(config, mockExecutor)
+
+	height := uint64(1200)
+	params := SwapParams{
+		AssetIn:  "HBD",
+		AssetOut: "HIVE",
+		AmountIn: 100000,
+		Sender:   "test-user",
+		Deadline: &schemas.Deadline{BlockHeight: &height},
+	}
+
+	_, err := svc.ExecuteSwap(params)
+	require.NoError(t, err)
+
+	require.Len(t, mockExecutor.executedOperations, 1)
+	payload := strings.TrimPrefix(mockExecutor.executedOperations[0], "execute:")
+	var instruction map[string]interface{}
+	err = json.Unmarshal([]byte(payload), &instruction)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{"block_height": float64(1200)}, instruction["deadline"])
+}
+
+func TestExecuteSwapWithReturnAddress(t *testing.T) {
+	mockExecutor := &mockDEXExecutor{}
+	config := VSCConfig{DexRouterContract: "dex-router-contract"}
+	svc := NewService(config, mockExecutor)
+
+	params := SwapParams{
+		AssetIn:       "BTC",
+		AssetOut:      "HBD",
+		AmountIn:      100000,
+		Sender:        "test-user",
+		ReturnAddress: &schemas.ReturnAddress{Chain: "BTC", Address: "bc1qrefund"},
+	}
+
+	_, err := svc.ExecuteSwap(params)
+	require.NoError(t, err)
+
+	require.Len(t, mockExecutor.executedOperations, 1)
+	payload := strings.TrimPrefix(mockExecutor.executedOperations[0], "execute:")
+	var instruction map[string]interface{}
+	err = json.Unmarshal([]byte(payload), &instruction)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{"chain": "BTC", "address": "bc1qrefund"}, instruction["return_address"])
+}
+
+func TestExecuteSwapContractError(t *testing.T) {
+	contractErr, ok := ParseContractError(`{"error":"E_POOL_NOT_FOUND","message":"no pool found for BTC/HBD"}`)
+	require.True(t, ok)
+	mockExecutor := &mockDEXExecutor{err: fmt.Errorf("execute: %w", contractErr)}
+	svc := NewService(VSCConfig{DexRouterContract: "dex-router-contract"}, mockExecutor)
+
+	result, err := svc.ExecuteSwap(SwapParams{AssetIn: "BTC", AssetOut: "HBD", AmountIn: 1000, Sender: "test-user"})
+
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "E_POOL_NOT_FOUND", result.ErrorCode)
+	assert.Contains(t, result.ErrorMessage, "no pool found for BTC/HBD")
+}
+
 func TestExecuteDeposit(t *testing.T) {
 	mockExecutor := &mockDEXExecutor{}
 	config := VSCConfig{DexRouterContract: "dex-router-contract"}
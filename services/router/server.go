@@ -82,12 +82,11 @@ func (s *Server) handleComputeRoute(w http.ResponseWriter, r *http.Request) {
 
 	result, err := s.router.ComputeRoute(r.Context(), params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	writeSwapResult(w, result)
 }
 
 // handleExecuteInstruction handles instruction-based swap requests
@@ -122,14 +121,36 @@ func (s *Server) handleExecuteInstruction(w http.ResponseWriter, r *http.Request
 	// Execute the swap
 	result, err := s.router.ComputeRoute(r.Context(), *params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
+	writeSwapResult(w, result)
+}
+
+// writeSwapResult answers with result, at the status its contract error code
+// maps to when the contract rejected the swap
+func writeSwapResult(w http.ResponseWriter, result *SwapResult) {
+	status := http.StatusOK
+	if !result.Success && result.ErrorCode != "" {
+		status = (&ContractError{Code: result.ErrorCode}).HTTPStatus()
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(result)
 }
 
+// writeError answers with err, at the status of the contract error behind it
+// or 400 Bad Request
+func writeError(w http.ResponseWriter, err error) {
+	if contractErr, ok := contractErrorOf(err); ok {
+		http.Error(w, contractErr.Error(), contractErr.HTTPStatus())
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
 // handleHealth provides health check endpoint
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,62 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleComputeRouteContractError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"success", nil, http.StatusOK, ""},
+		{"no pool", &ContractError{Code: "E_POOL_NOT_FOUND", Message: "no pool found for HBD/HIVE"}, http.StatusNotFound, "E_POOL_NOT_FOUND"},
+		{"wrapped", fmt.Errorf("call failed: %w", &ContractError{Code: "E_SLIPPAGE", Message: "slippage tolerance exceeded"}), http.StatusUnprocessableEntity, "E_SLIPPAGE"},
+		{"raw result", fmt.Errorf(`{"error":"E_POOL_PAUSED","message":"pool paused"}`), http.StatusServiceUnavailable, "E_POOL_PAUSED"},
+		{"not a contract error", fmt.Errorf("connection refused"), http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(VSCConfig{DexRouterContract: "dex-router-contract"}, &mockDEXExecutor{err: tt.err})
+			server := NewServer(svc, "0")
+
+			body := `{"fromAsset": "HBD", "toAsset": "HIVE", "amount": 1000}`
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/route", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			server.http.Handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			var result SwapResult
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+			assert.Equal(t, tt.err == nil, result.Success)
+			assert.Equal(t, tt.code, result.ErrorCode)
+		})
+	}
+}
+
+func TestHandleComputeRouteUnknownAsset(t *testing.T) {
+	svc := NewService(VSCConfig{DexRouterContract: "dex-router-contract"}, &mockDEXExecutor{})
+	svc.SetAssetRegistry(NewCachedAssetRegistry(testAssetQuerier(), 0))
+	server := NewServer(svc, "0")
+
+	body := `{"fromAsset": "HBD", "toAsset": "DOGE", "amount": 1000}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/route", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	server.http.Handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var result SwapResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, "E_UNKNOWN_ASSET", result.ErrorCode)
+}